@@ -0,0 +1,192 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/javi11/nntp-server-mock/nntpserver"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is prepended to the upper-cased flag name to form the
+// environment variable overriding it, e.g. NNTP_MOCK_IDLE_TIMEOUT.
+const envPrefix = "NNTP_MOCK_"
+
+// loadConfig builds the server configuration. Later sources win:
+// defaults, the config file, environment variables, then flags.
+func loadConfig(args []string) (nntpserver.Config, error) {
+	config := nntpserver.DefaultConfig()
+
+	// First pass only looks for the config file
+	var path string
+	pre := flag.NewFlagSet("nntp-server-mock", flag.ContinueOnError)
+	pre.SetOutput(io.Discard)
+	bindFlags(pre, &nntpserver.Config{}, &path, new(bool))
+	_ = pre.Parse(args)
+	if path == "" {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := loadConfigFile(path, &config); err != nil {
+			return config, err
+		}
+	}
+
+	var showVersion bool
+	fs := flag.NewFlagSet("nntp-server-mock", flag.ContinueOnError)
+	bindFlags(fs, &config, &path, &showVersion)
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := os.LookupEnv(name); ok && envErr == nil {
+			if err := fs.Set(f.Name, v); err != nil {
+				envErr = fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	})
+	if envErr != nil {
+		return config, envErr
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return config, err
+	}
+	if showVersion {
+		fmt.Printf("nntp-server-mock %s (%s, %s)\n", Version, GitCommit, Timestamp)
+		os.Exit(0)
+	}
+
+	return config, nil
+}
+
+func loadConfigFile(path string, config *nntpserver.Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("parsing config file: %w", err)
+	}
+	return nil
+}
+
+// bindFlags defines the command-line flags, using the values already in
+// config as defaults. Fault rules can only be set in the config file.
+func bindFlags(fs *flag.FlagSet, config *nntpserver.Config, path *string, showVersion *bool) {
+	fs.StringVar(path, "config", *path, "YAML config file")
+	fs.BoolVar(showVersion, "version", false, "print the version and exit")
+
+	fs.StringVar(&config.Address, "addr", config.Address, "address to listen on")
+	fs.StringVar(&config.AdminAddress, "admin-addr", config.AdminAddress, "address of the admin HTTP API (disabled if empty)")
+	fs.StringVar(&config.MetricsAddress, "metrics-addr", config.MetricsAddress, "address serving Prometheus metrics on /metrics (disabled if empty)")
+	fs.Func("backend", "storage backend: disk or memory", func(v string) error {
+		config.Backend = nntpserver.BackendType(v)
+		return nil
+	})
+	fs.StringVar(&config.DBPath, "db", config.DBPath, "database file (disk backend)")
+	fs.BoolVar(&config.CleanOnClose, "clean", config.CleanOnClose, "delete the database on shutdown")
+	fs.DurationVar(&config.Retention, "retention", config.Retention, "hide and delete articles older than this")
+	fs.DurationVar(&config.ExpireInterval, "expire-interval", config.ExpireInterval, "how often expired articles are deleted")
+	fs.Func("fixtures", "articles posted at startup: .eml directory, .json manifest or mbox file, comma separated or repeated", func(v string) error {
+		config.Fixtures = append(config.Fixtures, strings.Split(v, ",")...)
+		return nil
+	})
+	fs.Func("nzb", "NZB whose segments are generated from its files as file.nzb[:dir], comma separated or repeated", func(v string) error {
+		for _, spec := range strings.Split(v, ",") {
+			file, dir, _ := strings.Cut(spec, ":")
+			config.NZBs = append(config.NZBs, nntpserver.NZBSource{File: file, Dir: dir})
+		}
+		return nil
+	})
+
+	fs.BoolFunc("tls", "enable STARTTLS with a generated certificate", func(v string) error {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			config.TLS = nil
+			return nil
+		}
+		tlsConfig(config)
+		return nil
+	})
+	fs.Func("tls-cert", "PEM certificate file", func(v string) error {
+		tlsConfig(config).CertFile = v
+		return nil
+	})
+	fs.Func("tls-key", "PEM key file", func(v string) error {
+		tlsConfig(config).KeyFile = v
+		return nil
+	})
+	fs.BoolFunc("tls-implicit", "serve TLS from the first byte instead of STARTTLS", func(v string) error {
+		implicit, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		if implicit {
+			tlsConfig(config).Implicit = true
+		} else if config.TLS != nil {
+			config.TLS.Implicit = false
+		}
+		return nil
+	})
+
+	fs.BoolVar(&config.NoCompressWithTLS, "no-compress-tls", config.NoCompressWithTLS, "refuse COMPRESS DEFLATE on TLS sessions")
+
+	fs.Func("user", "accepted credentials as user:password, comma separated or repeated", func(v string) error {
+		for _, pair := range strings.Split(v, ",") {
+			user, pass, ok := strings.Cut(pair, ":")
+			if !ok {
+				return fmt.Errorf("expected user:password, got %q", pair)
+			}
+			auth := authConfig(config)
+			if auth.Users == nil {
+				auth.Users = map[string]string{}
+			}
+			auth.Users[user] = pass
+		}
+		return nil
+	})
+	fs.Func("htpasswd", "htpasswd file with bcrypt or {SHA} hashes", func(v string) error {
+		authConfig(config).HtpasswdFile = v
+		return nil
+	})
+	fs.BoolFunc("auth-required", "answer 480 until the client authenticates", func(v string) error {
+		required, err := strconv.ParseBool(v)
+		authConfig(config).Required = required
+		return err
+	})
+
+	fs.IntVar(&config.Connections.Max, "max-conns", config.Connections.Max, "maximum simultaneous connections")
+	fs.IntVar(&config.Connections.PerUser, "max-user-conns", config.Connections.PerUser, "maximum simultaneous connections per user")
+	fs.IntVar(&config.Bandwidth.Global, "rate", config.Bandwidth.Global, "bytes per second shared by all connections")
+	fs.IntVar(&config.Bandwidth.PerConnection, "conn-rate", config.Bandwidth.PerConnection, "bytes per second per connection")
+	fs.IntVar(&config.Bandwidth.PerUser, "user-rate", config.Bandwidth.PerUser, "bytes per second per user")
+	fs.IntVar(&config.Bandwidth.Burst, "burst", config.Bandwidth.Burst, "bytes sent without waiting")
+
+	fs.DurationVar(&config.IdleTimeout, "idle-timeout", config.IdleTimeout, "close connections idle for this long")
+	fs.DurationVar(&config.ReadTimeout, "read-timeout", config.ReadTimeout, "deadline for reading command data")
+	fs.DurationVar(&config.WriteTimeout, "write-timeout", config.WriteTimeout, "deadline for writing each response")
+	fs.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", config.ShutdownTimeout, "how long to wait for sessions on shutdown")
+	fs.Int64Var(&config.FaultSeed, "fault-seed", config.FaultSeed, "seed for fault injection")
+}
+
+func tlsConfig(config *nntpserver.Config) *nntpserver.TLSConfig {
+	if config.TLS == nil {
+		config.TLS = &nntpserver.TLSConfig{}
+	}
+	return config.TLS
+}
+
+func authConfig(config *nntpserver.Config) *nntpserver.AuthConfig {
+	if config.Auth == nil {
+		config.Auth = &nntpserver.AuthConfig{}
+	}
+	return config.Auth
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestTLSImplicitFlag(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		tls      bool
+		implicit bool
+	}{
+		{nil, false, false},
+		{[]string{"-tls-implicit"}, true, true},
+		{[]string{"-tls-implicit=true"}, true, true},
+		{[]string{"-tls-implicit=false"}, false, false},
+		{[]string{"-tls", "-tls-implicit=false"}, true, false},
+		{[]string{"-tls-implicit", "-tls-implicit=false"}, true, false},
+	} {
+		config, err := loadConfig(tc.args)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.args, err)
+		}
+		if (config.TLS != nil) != tc.tls {
+			t.Errorf("%q: TLS enabled = %v, want %v", tc.args, config.TLS != nil, tc.tls)
+			continue
+		}
+		if config.TLS != nil && config.TLS.Implicit != tc.implicit {
+			t.Errorf("%q: Implicit = %v, want %v", tc.args, config.TLS.Implicit, tc.implicit)
+		}
+	}
+}
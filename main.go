@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -10,11 +12,20 @@ import (
 	"github.com/javi11/nntp-server-mock/nntpserver"
 )
 
+// Set at build time by goreleaser.
+var (
+	Version   = "dev"
+	GitCommit = "none"
+	Timestamp = "unknown"
+)
+
 func main() {
-	config := nntpserver.Config{
-		Address:      ":1199",
-		DBPath:       "",
-		CleanOnClose: false,
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
 	}
 
 	s, err := nntpserver.NewServerWithConfig(config)
@@ -28,6 +39,12 @@ func main() {
 	}
 
 	fmt.Printf("Server listening on %s\n", s.Addr())
+	if addr := s.AdminAddr(); addr != nil {
+		fmt.Printf("Admin API listening on %s\n", addr)
+	}
+	if addr := s.MetricsAddr(); addr != nil {
+		fmt.Printf("Metrics served on http://%s/metrics\n", addr)
+	}
 
 	// Wait for interrupt signal for graceful shutdown
 	sigCh := make(chan os.Signal, 1)
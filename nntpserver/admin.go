@@ -0,0 +1,392 @@
+package nntpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrGroupExists = errors.New("group already exists")
+
+// storeAdmin is implemented by the backends the admin API can change.
+type storeAdmin interface {
+	CreateGroup(name, description string) (*Group, error)
+	DeleteGroup(name string) error
+	DeleteArticle(id string) error
+	Reset() error
+}
+
+// adminStore returns the storage under the wrappers of backend.
+func adminStore(backend Backend) (storeAdmin, bool) {
+	for {
+		switch b := backend.(type) {
+		case storeAdmin:
+			return b, true
+		case *authBackend:
+			backend = b.Backend
+		case *providerView:
+			backend = b.Backend
+		case *meteredBackend:
+			backend = b.Backend
+		default:
+			return nil, false
+		}
+	}
+}
+
+// groupInfo is the JSON form of a group.
+type groupInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Count       int64  `json:"count"`
+	Low         int64  `json:"low"`
+	High        int64  `json:"high"`
+	Posting     string `json:"posting"`
+}
+
+func newGroupInfo(g *Group) groupInfo {
+	return groupInfo{
+		Name:        g.Name,
+		Description: g.Description,
+		Count:       g.Count,
+		Low:         g.Low,
+		High:        g.High,
+		Posting:     g.Posting.String(),
+	}
+}
+
+// sessionInfo is the JSON form of an active session.
+type sessionInfo struct {
+	ID         uint64    `json:"id"`
+	RemoteAddr string    `json:"remote_addr"`
+	User       string    `json:"user,omitempty"`
+	Started    time.Time `json:"started"`
+}
+
+// AdminHandler returns the admin HTTP API of the server. It changes the
+// same backend the NNTP sessions use:
+//
+//	GET    /groups            list groups
+//	POST   /groups            create a group from {"name", "description"}
+//	GET    /groups/{name}     show a group
+//	DELETE /groups/{name}     delete a group and the articles only in it
+//	POST   /articles          post the RFC 5322 message in the request body
+//	DELETE /articles/{id}     delete an article by message-id
+//	GET    /faults            show the fault rules
+//	PUT    /faults            replace the fault rules
+//	DELETE /faults            remove all fault rules
+//	GET    /corruptions       show the yEnc corruption rules
+//	PUT    /corruptions       replace the yEnc corruption rules
+//	DELETE /corruptions       remove all yEnc corruption rules
+//	GET    /sessions          list active sessions
+//	DELETE /sessions/{id}     close a session
+//	POST   /reset             delete all articles and groups
+//	GET    /metrics           Prometheus metrics, see MetricsHandler
+//
+// Rules use the field names of the config file and may be sent as JSON or
+// YAML.
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /groups", s.adminListGroups)
+	mux.HandleFunc("POST /groups", s.adminCreateGroup)
+	mux.HandleFunc("GET /groups/{name}", s.adminGetGroup)
+	mux.HandleFunc("DELETE /groups/{name}", s.adminDeleteGroup)
+	mux.HandleFunc("POST /articles", s.adminPostArticle)
+	mux.HandleFunc("DELETE /articles/{id}", s.adminDeleteArticle)
+	mux.HandleFunc("GET /faults", func(w http.ResponseWriter, r *http.Request) {
+		writeRules(w, s.FaultRules())
+	})
+	mux.HandleFunc("PUT /faults", s.adminSetFaults)
+	mux.HandleFunc("DELETE /faults", func(w http.ResponseWriter, r *http.Request) {
+		s.SetFaultRules(nil)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /corruptions", func(w http.ResponseWriter, r *http.Request) {
+		writeRules(w, s.CorruptionRules())
+	})
+	mux.HandleFunc("PUT /corruptions", s.adminSetCorruptions)
+	mux.HandleFunc("DELETE /corruptions", func(w http.ResponseWriter, r *http.Request) {
+		s.SetCorruptionRules(nil)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /sessions", s.adminListSessions)
+	mux.HandleFunc("DELETE /sessions/{id}", s.adminKickSession)
+	mux.HandleFunc("POST /reset", s.adminReset)
+	mux.Handle("GET /metrics", s.MetricsHandler())
+	return mux
+}
+
+// serveHTTP serves handler on addr until Stop.
+func (s *Server) serveHTTP(addr string, handler http.Handler) (*http.Server, net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listening: %w", err)
+	}
+
+	srv := &http.Server{Handler: handler}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := srv.Serve(listener); err != http.ErrServerClosed {
+			log.Printf("Error serving HTTP on %s: %v", addr, err)
+		}
+	}()
+	return srv, listener, nil
+}
+
+// AdminAddr returns the address of the admin API, nil if it isn't served.
+func (s *Server) AdminAddr() net.Addr {
+	if s.adminListener == nil {
+		return nil
+	}
+	return s.adminListener.Addr()
+}
+
+func (s *Server) adminListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := s.Backend.ListGroups(-1)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	infos := make([]groupInfo, len(groups))
+	for i, g := range groups {
+		infos[i] = newGroupInfo(g)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) adminCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || strings.ContainsAny(req.Name, " \t\r\n") {
+		http.Error(w, "invalid group name", http.StatusBadRequest)
+		return
+	}
+
+	store, ok := adminStore(s.Backend)
+	if !ok {
+		http.Error(w, "backend cannot be changed", http.StatusNotImplemented)
+		return
+	}
+	group, err := store.CreateGroup(req.Name, req.Description)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newGroupInfo(group))
+}
+
+func (s *Server) adminGetGroup(w http.ResponseWriter, r *http.Request) {
+	// GetGroup creates missing groups, so look among the existing ones
+	groups, err := s.Backend.ListGroups(-1)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for _, g := range groups {
+		if g.Name == r.PathValue("name") {
+			writeJSON(w, http.StatusOK, newGroupInfo(g))
+			return
+		}
+	}
+	writeError(w, ErrNoSuchGroup)
+}
+
+func (s *Server) adminDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	store, ok := adminStore(s.Backend)
+	if !ok {
+		http.Error(w, "backend cannot be changed", http.StatusNotImplemented)
+		return
+	}
+	if err := store.DeleteGroup(r.PathValue("name")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminPostArticle(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	article, err := parseMessage(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if article.MessageID() == "" {
+		http.Error(w, "article has no Message-Id", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Backend.Post(article); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"message_id": article.MessageID()})
+}
+
+func (s *Server) adminDeleteArticle(w http.ResponseWriter, r *http.Request) {
+	store, ok := adminStore(s.Backend)
+	if !ok {
+		http.Error(w, "backend cannot be changed", http.StatusNotImplemented)
+		return
+	}
+	id := "<" + strings.Trim(r.PathValue("id"), "<>") + ">"
+	if err := store.DeleteArticle(id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminSetFaults(w http.ResponseWriter, r *http.Request) {
+	var rules []FaultRule
+	if !readRules(w, r, &rules) {
+		return
+	}
+	if err := s.SetFaultRules(rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeRules(w, s.FaultRules())
+}
+
+func (s *Server) adminSetCorruptions(w http.ResponseWriter, r *http.Request) {
+	var rules []CorruptionRule
+	if !readRules(w, r, &rules) {
+		return
+	}
+	for _, rule := range rules {
+		if !rule.Mode.valid() {
+			http.Error(w, fmt.Sprintf("unknown yEnc corruption %q", rule.Mode), http.StatusBadRequest)
+			return
+		}
+	}
+	s.SetCorruptionRules(rules)
+	writeRules(w, s.CorruptionRules())
+}
+
+func (s *Server) adminListSessions(w http.ResponseWriter, r *http.Request) {
+	s.connsMu.Lock()
+	infos := make([]sessionInfo, 0, len(s.sessions))
+	for sess := range s.sessions {
+		infos = append(infos, sessionInfo{
+			ID:         sess.id,
+			RemoteAddr: sess.raw.RemoteAddr().String(),
+			User:       sess.user,
+			Started:    sess.started,
+		})
+	}
+	s.connsMu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) adminKickSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for sess := range s.sessions {
+		if sess.id == id {
+			sess.raw.Close()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	http.Error(w, "no such session", http.StatusNotFound)
+}
+
+func (s *Server) adminReset(w http.ResponseWriter, r *http.Request) {
+	store, ok := adminStore(s.Backend)
+	if !ok {
+		http.Error(w, "backend cannot be changed", http.StatusNotImplemented)
+		return
+	}
+	if err := store.Reset(); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with the HTTP status matching a backend error.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case ErrNoSuchGroup, ErrInvalidMessageID:
+		status = http.StatusNotFound
+	case ErrGroupExists, ErrDuplicateArticle:
+		status = http.StatusConflict
+	}
+	msg := err.Error()
+	if nerr, ok := err.(*NNTPError); ok {
+		msg = nerr.Msg
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+	}
+	http.Error(w, msg, status)
+}
+
+// readRules decodes the rules in the request body into rules, answering
+// 400 when they are invalid.
+func readRules(w http.ResponseWriter, r *http.Request, rules any) bool {
+	data, err := io.ReadAll(r.Body)
+	if err == nil {
+		// JSON is YAML too
+		err = yaml.Unmarshal(data, rules)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeRules sends rules as JSON, with the field names and durations of
+// the config file.
+func writeRules(w http.ResponseWriter, rules any) {
+	data, err := yaml.Marshal(rules)
+	var v any
+	if err == nil {
+		err = yaml.Unmarshal(data, &v)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
@@ -0,0 +1,46 @@
+package nntpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminDeleteGroupInUse(t *testing.T) {
+	s := startServer(t, Config{})
+	postArticles(t, s.Backend, "foo", "<a1@test>", "<a2@test>")
+
+	c := dial(t, s)
+	c.check("211 2 1 2 foo", "GROUP foo")
+	c.check("223 1 <a1@test>", "STAT 1")
+
+	req := httptest.NewRequest(http.MethodDelete, "/groups/foo", nil)
+	rec := httptest.NewRecorder()
+	s.AdminHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /groups/foo: got %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	c.check("411", "STAT 1")
+	c.check("411", "HEAD 2")
+	c.check("430", "STAT <a1@test>")
+	c.check("205", "QUIT")
+}
+
+func TestAdminResetWithGroupSelected(t *testing.T) {
+	s := startServer(t, Config{})
+	postArticles(t, s.Backend, "foo", "<a1@test>")
+
+	c := dial(t, s)
+	c.check("211 1 1 1 foo", "GROUP foo")
+
+	req := httptest.NewRequest(http.MethodPost, "/reset", nil)
+	rec := httptest.NewRecorder()
+	s.AdminHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("POST /reset: got %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	c.check("411", "ARTICLE 1")
+	c.check("205", "QUIT")
+}
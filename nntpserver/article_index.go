@@ -0,0 +1,142 @@
+package nntpserver
+
+import (
+	"fmt"
+	"sort"
+)
+
+type indexEntry struct {
+	Num     int64
+	Id      string
+	Arrived int64 // unix nanoseconds, 0 if unknown
+}
+
+// live reports whether the entry is within retention. cutoff is the
+// arrival time before which articles expire, entries of unknown age never do.
+func (e indexEntry) live(cutoff int64) bool {
+	return e.Arrived == 0 || e.Arrived >= cutoff
+}
+
+// articleIndex is an ordered article number to message-id mapping.
+type articleIndex struct {
+	Entries []indexEntry
+	Next    int64
+}
+
+func newArticleIndex() *articleIndex {
+	return &articleIndex{Next: 1}
+}
+
+// insert stores id under num, which must not be in use.
+func (idx *articleIndex) insert(num int64, id string, arrived int64) {
+	i := sort.Search(len(idx.Entries), func(i int) bool {
+		return idx.Entries[i].Num >= num
+	})
+	idx.Entries = append(idx.Entries, indexEntry{})
+	copy(idx.Entries[i+1:], idx.Entries[i:])
+	idx.Entries[i] = indexEntry{Num: num, Id: id, Arrived: arrived}
+	if num >= idx.Next {
+		idx.Next = num + 1
+	}
+}
+
+// summary returns the number of live entries and the low and high water
+// marks. Without live entries it reports high = low - 1 as RFC 3977
+// suggests.
+func (idx *articleIndex) summary(cutoff int64) (count, low, high int64) {
+	if cutoff == 0 {
+		if len(idx.Entries) == 0 {
+			return 0, idx.Next, idx.Next - 1
+		}
+		return int64(len(idx.Entries)), idx.Entries[0].Num, idx.Entries[len(idx.Entries)-1].Num
+	}
+
+	for _, e := range idx.Entries {
+		if !e.live(cutoff) {
+			continue
+		}
+		if count == 0 {
+			low = e.Num
+		}
+		high = e.Num
+		count++
+	}
+	if count == 0 {
+		return 0, idx.Next, idx.Next - 1
+	}
+	return count, low, high
+}
+
+// prune removes the entries that expired before cutoff and returns them.
+func (idx *articleIndex) prune(cutoff int64) []indexEntry {
+	var pruned []indexEntry
+	kept := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if e.live(cutoff) {
+			kept = append(kept, e)
+		} else {
+			pruned = append(pruned, e)
+		}
+	}
+	idx.Entries = kept
+	return pruned
+}
+
+// remove drops the entry stored under num.
+func (idx *articleIndex) remove(num int64) {
+	i := sort.Search(len(idx.Entries), func(i int) bool {
+		return idx.Entries[i].Num >= num
+	})
+	if i < len(idx.Entries) && idx.Entries[i].Num == num {
+		idx.Entries = append(idx.Entries[:i], idx.Entries[i+1:]...)
+	}
+}
+
+// get returns the message-id stored under num.
+func (idx *articleIndex) get(num int64) (string, bool) {
+	i := sort.Search(len(idx.Entries), func(i int) bool {
+		return idx.Entries[i].Num >= num
+	})
+	if i < len(idx.Entries) && idx.Entries[i].Num == num {
+		return idx.Entries[i].Id, true
+	}
+	return "", false
+}
+
+// between returns the entries with from <= num <= to.
+func (idx *articleIndex) between(from, to int64) []indexEntry {
+	if from > to {
+		return nil
+	}
+	lo := sort.Search(len(idx.Entries), func(i int) bool {
+		return idx.Entries[i].Num >= from
+	})
+	hi := sort.Search(len(idx.Entries), func(i int) bool {
+		return idx.Entries[i].Num > to
+	})
+	if lo >= hi {
+		return nil
+	}
+	rv := make([]indexEntry, hi-lo)
+	copy(rv, idx.Entries[lo:hi])
+	return rv
+}
+
+// numberArticle picks the number of an article in each of its groups: the
+// one from its Xref header when given, the next free one otherwise.
+// The indexes of all groups must exist.
+func numberArticle(names []string, xref map[string]int64, indexes map[string]*articleIndex) (map[string]int64, error) {
+	groups := make(map[string]int64, len(names))
+	for _, name := range names {
+		num, ok := xref[name]
+		if !ok {
+			groups[name] = indexes[name].Next
+			continue
+		}
+		if _, taken := indexes[name].get(num); taken {
+			return nil, fmt.Errorf("article number %d already used in %s", num, name)
+		}
+		groups[name] = num
+	}
+	return groups, nil
+}
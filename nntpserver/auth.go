@@ -0,0 +1,140 @@
+package nntpserver
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrAuthOutOfSequence = &NNTPError{482, "Authentication commands issued out of sequence"}
+
+// AuthConfig holds the credentials accepted by AUTHINFO.
+type AuthConfig struct {
+	// Inline users, mapping user names to plain text passwords
+	Users map[string]string `yaml:"users"`
+	// htpasswd style file with bcrypt ($2y$) or {SHA} hashes
+	HtpasswdFile string `yaml:"htpasswd_file"`
+	// Answer 480 to every article command until the client authenticates
+	Required bool `yaml:"required"`
+}
+
+// userDB checks credentials against plain text passwords or htpasswd hashes.
+type userDB struct {
+	passwords map[string]string
+	hashes    map[string]string
+}
+
+func newUserDB(config *AuthConfig) (*userDB, error) {
+	db := &userDB{
+		passwords: config.Users,
+		hashes:    map[string]string{},
+	}
+
+	if config.HtpasswdFile != "" {
+		f, err := os.Open(config.HtpasswdFile)
+		if err != nil {
+			return nil, fmt.Errorf("opening htpasswd file: %w", err)
+		}
+		defer f.Close()
+
+		if err := db.loadHtpasswd(f); err != nil {
+			return nil, fmt.Errorf("reading htpasswd file: %w", err)
+		}
+	}
+
+	return db, nil
+}
+
+func (db *userDB) loadHtpasswd(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("malformed line for %q", user)
+		}
+		db.hashes[user] = hash
+	}
+	return scanner.Err()
+}
+
+func (db *userDB) check(user, pass string) bool {
+	if want, ok := db.passwords[user]; ok {
+		return subtle.ConstantTimeCompare([]byte(want), []byte(pass)) == 1
+	}
+
+	hash, ok := db.hashes[user]
+	if !ok {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		want := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(hash[len("{SHA}"):]), []byte(want)) == 1
+	}
+	return false
+}
+
+// authBackend wraps a Backend with a user database. Authenticate hands out
+// a copy bound to the user that reports itself as authorized.
+type authBackend struct {
+	Backend
+	users    *userDB
+	required bool
+	user     string
+}
+
+func newAuthBackend(backend Backend, config *AuthConfig) (*authBackend, error) {
+	users, err := newUserDB(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authBackend{
+		Backend:  backend,
+		users:    users,
+		required: config.Required,
+	}, nil
+}
+
+func (a *authBackend) Authorized() bool {
+	return a.user != "" || !a.required
+}
+
+func (a *authBackend) Authenticate(user, pass string) (Backend, error) {
+	if !a.users.check(user, pass) {
+		return nil, ErrAuthRejected
+	}
+
+	rv := *a
+	rv.user = user
+	return &rv, nil
+}
+
+func (a *authBackend) ArticleNumbers(group *Group, from, to int64) ([]int64, error) {
+	return articleNumbers(a.Backend, group, from, to)
+}
+
+func (a *authBackend) HasArticle(id string) (bool, error) {
+	return hasArticle(a.Backend, id)
+}
+
+func (a *authBackend) Close() error {
+	if closer, ok := a.Backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package nntpserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/textproto"
+	"strings"
+
+	"github.com/javi11/nntp-server-mock/yenc"
+)
+
+// BinaryPost describes a file posted as yEnc encoded articles.
+type BinaryPost struct {
+	Name string
+	Data []byte
+	// Bytes of the file per article, 0 posts a single article
+	PartSize int
+	// Encoded characters per line, 0 for yenc.DefaultLineLength
+	LineLength int
+	// Groups posted to (defaults to DefaultGroup)
+	Groups []string
+	From   string
+	// Message-ids of the articles, one per part. Missing ones are
+	// derived from the file checksum and part number.
+	MessageIDs []string
+}
+
+// articles returns the yEnc articles of the post.
+func (p *BinaryPost) articles() ([]*Article, error) {
+	parts := yenc.Split(p.Name, p.Data, p.PartSize)
+	if len(p.MessageIDs) > len(parts) {
+		return nil, fmt.Errorf("%s: %d message-ids for %d parts", p.Name, len(p.MessageIDs), len(parts))
+	}
+
+	articles := make([]*Article, len(parts))
+	for i, part := range parts {
+		id := fmt.Sprintf("<%08x.%d.%d@nntp-server-mock>", part.CRC32, part.Size, part.Number)
+		if i < len(p.MessageIDs) {
+			id = "<" + strings.Trim(p.MessageIDs[i], "<>") + ">"
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Message-Id", id)
+		header.Set("Subject", part.Subject())
+		if len(p.Groups) > 0 {
+			header.Set("Newsgroups", strings.Join(p.Groups, ","))
+		}
+		if p.From != "" {
+			header.Set("From", p.From)
+		}
+
+		body := new(bytes.Buffer)
+		if err := part.Encode(body, p.LineLength); err != nil {
+			return nil, err
+		}
+		articles[i] = &Article{Header: header, Body: body}
+	}
+
+	return articles, nil
+}
+
+// PostBinary yEnc encodes a file and posts its articles to backend, with
+// subjects in the `"name" yEnc (1/N)` form. It returns the message-ids of
+// the articles in part order, including those that were already stored.
+func PostBinary(backend Backend, post BinaryPost) ([]string, error) {
+	articles, err := post.articles()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(articles))
+	for _, article := range articles {
+		err := backend.Post(article)
+		if err != nil && err != ErrDuplicateArticle {
+			return ids, fmt.Errorf("posting %s: %w", article.MessageID(), err)
+		}
+		ids = append(ids, article.MessageID())
+	}
+	return ids, nil
+}
@@ -0,0 +1,84 @@
+package nntpserver
+
+import (
+	"compress/flate"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// deflateConn compresses both directions of a connection with raw DEFLATE
+// as RFC 8054 requires, flushing after every write so responses are not
+// held back.
+type deflateConn struct {
+	net.Conn
+	r io.ReadCloser
+	w *flate.Writer
+}
+
+func newDeflateConn(nc net.Conn) (*deflateConn, error) {
+	w, err := flate.NewWriter(nc, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	return &deflateConn{Conn: nc, r: flate.NewReader(nc), w: w}, nil
+}
+
+func (dc *deflateConn) Read(p []byte) (int, error) {
+	return dc.r.Read(p)
+}
+
+func (dc *deflateConn) Write(p []byte) (int, error) {
+	n, err := dc.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, dc.w.Flush()
+}
+
+func (dc *deflateConn) Close() error {
+	dc.w.Close()
+	dc.r.Close()
+	return dc.Conn.Close()
+}
+
+// compressAllowed reports whether the session may start compression.
+func (s *session) compressAllowed() bool {
+	return !s.compressed && !(s.tls && s.server.config.NoCompressWithTLS)
+}
+
+/*
+   Syntax
+     COMPRESS DEFLATE
+
+   Responses
+     206    Compression active
+     403    Unable to activate compression
+     502    Command unavailable [1]
+
+   [1] The 502 response is sent if compression is already active, or the
+   session uses TLS and the server is configured to refuse compression
+   on top of it.
+*/
+
+func handleCompress(args []string, s *session, c *textproto.Conn) error {
+	if len(args) != 1 || !strings.EqualFold(args[0], "deflate") {
+		return ErrSyntax
+	}
+	if !s.compressAllowed() {
+		return ErrCommandUnavailable
+	}
+
+	dc, err := newDeflateConn(s.conn)
+	if err != nil {
+		return &NNTPError{403, "Unable to activate compression"}
+	}
+	if err := c.PrintfLine("206 Compression active"); err != nil {
+		return err
+	}
+	s.setConn(dc)
+	s.compressed = true
+
+	return nil
+}
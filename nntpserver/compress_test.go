@@ -0,0 +1,122 @@
+package nntpserver
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"math/rand"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// compress starts compression on c and switches it to the deflate stream.
+func (c *client) compress() {
+	c.t.Helper()
+	c.check("206", "COMPRESS DEFLATE")
+
+	dc, err := newDeflateConn(c.conn)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.conn = dc
+	c.Conn = textproto.NewConn(dc)
+}
+
+func TestCompress(t *testing.T) {
+	s := startServer(t, Config{
+		TLS:  &TLSConfig{},
+		Auth: &AuthConfig{Users: map[string]string{"user": "pass"}},
+	})
+	postArticles(t, s.Backend, "foo", "<a1@test>")
+
+	c := dial(t, s)
+	c.check("501", "COMPRESS")
+	c.check("501", "COMPRESS GZIP")
+	if !slices.Contains(c.capabilities(), "COMPRESS DEFLATE") {
+		t.Fatal("COMPRESS not announced")
+	}
+
+	// Allowed before authentication, which then goes through the stream
+	c.compress()
+	caps := c.capabilities()
+	if slices.Contains(caps, "COMPRESS DEFLATE") || slices.Contains(caps, "STARTTLS") {
+		t.Errorf("COMPRESS or STARTTLS announced on a compressed session: %q", caps)
+	}
+	c.check("502", "COMPRESS DEFLATE")
+	c.check("502", "STARTTLS")
+	c.check("381", "AUTHINFO USER user")
+	c.check("281", "AUTHINFO PASS pass")
+
+	c.check("222 0 <a1@test>", "BODY <a1@test>")
+	if got := c.block(); !slices.Equal(got, []string{"line one", "line two"}) {
+		t.Errorf("BODY: got %q", got)
+	}
+	c.check("205", "QUIT")
+}
+
+func TestCompressAfterTLS(t *testing.T) {
+	for _, refuse := range []bool{false, true} {
+		s := startServer(t, Config{TLS: &TLSConfig{}, NoCompressWithTLS: refuse})
+
+		c := dial(t, s)
+		c.check("382", "STARTTLS")
+		conn := tls.Client(c.conn, &tls.Config{ServerName: "localhost", RootCAs: s.RootCAs()})
+		if err := conn.Handshake(); err != nil {
+			t.Fatalf("handshake: %v", err)
+		}
+		c.conn = conn
+		c.Conn = textproto.NewConn(conn)
+
+		if got := slices.Contains(c.capabilities(), "COMPRESS DEFLATE"); got == refuse {
+			t.Errorf("no_compress_with_tls %v: COMPRESS announced %v", refuse, got)
+		}
+		if refuse {
+			c.check("502", "COMPRESS DEFLATE")
+			continue
+		}
+		c.compress()
+		c.check("211", "GROUP foo")
+	}
+}
+
+func TestCompressThrottle(t *testing.T) {
+	const rate = 20000
+
+	s := startServer(t, Config{Bandwidth: BandwidthConfig{PerConnection: rate, Burst: 1000}})
+
+	random := make([]byte, rate*3/4)
+	rand.New(rand.NewSource(1)).Read(random)
+	post := func(id, data string) {
+		var body strings.Builder
+		for len(data) > 0 {
+			n := min(len(data), 76)
+			body.WriteString(data[:n] + "\r\n")
+			data = data[n:]
+		}
+		c := dial(t, s)
+		c.post("Message-Id: "+id+"\nNewsgroups: foo", strings.TrimSuffix(body.String(), "\r\n"))
+	}
+	post("<random@test>", base64.StdEncoding.EncodeToString(random))
+	post("<same@test>", strings.Repeat("x", rate))
+
+	// fetch times BODY id on a compressed connection
+	fetch := func(id string) time.Duration {
+		c := dial(t, s)
+		c.compress()
+		start := time.Now()
+		c.check("222", "BODY %s", id)
+		c.block()
+		return time.Since(start)
+	}
+
+	// About a second worth of data either way, but only the random body
+	// stays that large once compressed
+	if took := fetch("<random@test>"); took < 500*time.Millisecond {
+		t.Errorf("random body sent in %v, want the rate applied", took)
+	}
+	if took := fetch("<same@test>"); took > 300*time.Millisecond {
+		t.Errorf("compressible body sent in %v, want its compressed size throttled", took)
+	}
+}
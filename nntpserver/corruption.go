@@ -0,0 +1,242 @@
+package nntpserver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// YEncCorruption is a kind of damage done to a yEnc body.
+type YEncCorruption string
+
+// YEncCorruption values.
+const (
+	// Wrong pcrc32 in =yend (crc32 for single-part bodies)
+	CorruptPCRC32 = YEncCorruption("pcrc32")
+	// No =yend line
+	CorruptMissingYEnd = YEncCorruption("missing_yend")
+	// Second half of the data lines left out
+	CorruptTruncate = YEncCorruption("truncate")
+	// Lines starting with a dot sent without dot-stuffing, so the client
+	// drops their first character. Bodies without such lines are unchanged.
+	CorruptUnstuffedDots = YEncCorruption("unstuffed_dots")
+	// An escape character with nothing to escape at the end of the first
+	// data line
+	CorruptBadEscape = YEncCorruption("bad_escape")
+	// size= in =yend one more than the data sent
+	CorruptSizeMismatch = YEncCorruption("size_mismatch")
+)
+
+func (m YEncCorruption) valid() bool {
+	switch m {
+	case CorruptPCRC32, CorruptMissingYEnd, CorruptTruncate,
+		CorruptUnstuffedDots, CorruptBadEscape, CorruptSizeMismatch:
+		return true
+	}
+	return false
+}
+
+// CorruptionRule damages the yEnc bodies served by BODY that it matches.
+type CorruptionRule struct {
+	Mode YEncCorruption `yaml:"mode"`
+	// Message-ids the rule applies to, empty for every yEnc body
+	MessageIDs []string `yaml:"message_ids"`
+	// Probability (0-1) of damaging a matching body, 0 always does
+	Probability float64 `yaml:"probability"`
+}
+
+func (r *CorruptionRule) matches(id string) bool {
+	if len(r.MessageIDs) == 0 {
+		return true
+	}
+	for _, m := range r.MessageIDs {
+		if "<"+strings.Trim(m, "<>")+">" == id {
+			return true
+		}
+	}
+	return false
+}
+
+// corruptor holds the corruption rules of a server. They may be replaced
+// while sessions are running.
+type corruptor struct {
+	mu    sync.Mutex
+	rules []CorruptionRule
+	rand  *rand.Rand
+}
+
+func newCorruptor(rules []CorruptionRule, seed int64) *corruptor {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &corruptor{
+		rules: rules,
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (c *corruptor) setRules(rules []CorruptionRule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = append([]CorruptionRule(nil), rules...)
+}
+
+func (c *corruptor) getRules() []CorruptionRule {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]CorruptionRule(nil), c.rules...)
+}
+
+// roll picks the corruption of the article with message-id id from the
+// first matching rule, "" for none.
+func (c *corruptor) roll(id string) YEncCorruption {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, r := range c.rules {
+		if !r.matches(id) {
+			continue
+		}
+		if r.Probability > 0 && c.rand.Float64() >= r.Probability {
+			return ""
+		}
+		return r.Mode
+	}
+	return ""
+}
+
+// active reports whether any rule is set.
+func (c *corruptor) active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.rules) > 0
+}
+
+// SetCorruptionRules replaces the yEnc corruption rules; sessions pick them
+// up with their next BODY command.
+func (s *Server) SetCorruptionRules(rules []CorruptionRule) {
+	s.corruptor.setRules(rules)
+}
+
+// CorruptionRules returns a copy of the current yEnc corruption rules.
+func (s *Server) CorruptionRules() []CorruptionRule {
+	return s.corruptor.getRules()
+}
+
+var yencSizePattern = regexp.MustCompile(`\bsize=(\d+)`)
+var yencCRCPattern = regexp.MustCompile(`\b(p?crc32)=([0-9a-fA-F]+)`)
+
+// isYEnc reports whether body holds a yEnc encoded file.
+func isYEnc(body []byte) bool {
+	return bytes.HasPrefix(body, []byte("=ybegin ")) || bytes.Contains(body, []byte("\n=ybegin "))
+}
+
+// corrupt returns body damaged as mode says.
+func corrupt(body []byte, mode YEncCorruption) ([]byte, error) {
+	lines := strings.SplitAfter(string(body), "\n")
+	yend := -1
+	var data []int
+	for i, l := range lines {
+		switch {
+		case strings.HasPrefix(l, "=yend"):
+			yend = i
+		case strings.HasPrefix(l, "=ybegin"), strings.HasPrefix(l, "=ypart"):
+		case yend < 0 && strings.TrimRight(l, "\r\n") != "":
+			data = append(data, i)
+		}
+	}
+
+	switch mode {
+	case CorruptPCRC32:
+		if yend < 0 {
+			break
+		}
+		crc := yencCRCPattern.FindAllStringSubmatch(lines[yend], -1)
+		if len(crc) == 0 {
+			break
+		}
+		// Multi-part bodies carry pcrc32 first
+		name, value := crc[0][1], crc[0][2]
+		v, _ := strconv.ParseUint(value, 16, 32)
+		lines[yend] = strings.Replace(lines[yend], name+"="+value, fmt.Sprintf("%s=%08x", name, ^uint32(v)), 1)
+	case CorruptMissingYEnd:
+		if yend >= 0 {
+			lines[yend] = ""
+		}
+	case CorruptTruncate:
+		for _, i := range data[len(data)/2:] {
+			lines[i] = ""
+		}
+	case CorruptBadEscape:
+		if len(data) > 0 {
+			l := lines[data[0]]
+			trimmed := strings.TrimRight(l, "\r\n")
+			lines[data[0]] = trimmed + "=" + l[len(trimmed):]
+		}
+	case CorruptSizeMismatch:
+		if yend >= 0 {
+			lines[yend] = yencSizePattern.ReplaceAllStringFunc(lines[yend], func(m string) string {
+				n, _ := strconv.Atoi(m[len("size="):])
+				return "size=" + strconv.Itoa(n+1)
+			})
+		}
+	case CorruptUnstuffedDots:
+		// Done while sending, see writeUnstuffed
+	default:
+		return nil, fmt.Errorf("unknown yEnc corruption %q", mode)
+	}
+
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// writeUnstuffed sends body as a multi-line block without doubling the dots
+// at the start of lines.
+func writeUnstuffed(w *bufio.Writer, body []byte) error {
+	for _, line := range strings.SplitAfter(string(body), "\n") {
+		if line == "" {
+			continue
+		}
+		w.WriteString(strings.TrimRight(line, "\r\n"))
+		w.WriteString("\r\n")
+	}
+	w.WriteString(".\r\n")
+	return w.Flush()
+}
+
+// writeBody sends the body of article as a multi-line block, damaging it
+// when a corruption rule fires.
+func (s *session) writeBody(article *Article, c *textproto.Conn) error {
+	body := article.Body
+	if s.server.corruptor.active() {
+		data, err := io.ReadAll(article.Body)
+		if err != nil {
+			return err
+		}
+		mode := YEncCorruption("")
+		if isYEnc(data) {
+			mode = s.server.corruptor.roll(article.MessageID())
+		}
+		if mode != "" {
+			if data, err = corrupt(data, mode); err != nil {
+				return err
+			}
+			if mode == CorruptUnstuffedDots {
+				return writeUnstuffed(c.W, data)
+			}
+		}
+		body = bytes.NewReader(data)
+	}
+
+	dw := c.DotWriter()
+	defer dw.Close()
+	_, err := io.Copy(dw, body)
+	return err
+}
@@ -0,0 +1,150 @@
+package nntpserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/javi11/nntp-server-mock/yenc"
+)
+
+// yencPart returns the lines of the first of two yEnc parts, whose first
+// data line starts with a dot.
+func yencPart(t *testing.T) (part yenc.Part, lines []string) {
+	t.Helper()
+
+	data := make([]byte, 400)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	data[0] = '.' - 42
+
+	part = yenc.Split("file.bin", data, 200)[0]
+	var buf bytes.Buffer
+	if err := part.Encode(&buf, 32); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return part, strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// postBody stores an article with the given body lines in group foo.
+func postBody(t *testing.T, b Backend, id string, lines []string) {
+	t.Helper()
+	if err := b.Post(&Article{
+		Header: textproto.MIMEHeader{"Message-Id": {id}, "Newsgroups": {"foo"}},
+		Body:   strings.NewReader(strings.Join(lines, "\n") + "\n"),
+	}); err != nil {
+		t.Fatalf("posting %s: %v", id, err)
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	part, lines := yencPart(t)
+	// lines holds =ybegin, =ypart, the data lines and =yend
+	data := lines[2 : len(lines)-1]
+	yend := lines[len(lines)-1]
+
+	for _, tc := range []struct {
+		mode YEncCorruption
+		want []string
+	}{
+		{CorruptPCRC32, slices.Concat(lines[:len(lines)-1], []string{strings.Replace(yend,
+			fmt.Sprintf("pcrc32=%08x", part.PCRC32()), fmt.Sprintf("pcrc32=%08x", ^part.PCRC32()), 1)})},
+		{CorruptSizeMismatch, slices.Concat(lines[:len(lines)-1], []string{strings.Replace(yend,
+			"size=200", "size=201", 1)})},
+		{CorruptMissingYEnd, lines[:len(lines)-1]},
+		{CorruptTruncate, slices.Concat(lines[:2], data[:len(data)/2], []string{yend})},
+		// The client takes the leading dot for stuffing
+		{CorruptUnstuffedDots, slices.Concat(lines[:2], []string{data[0][1:]}, data[1:], []string{yend})},
+		{CorruptBadEscape, slices.Concat(lines[:2], []string{data[0] + "="}, data[1:], []string{yend})},
+	} {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			s := startServer(t, Config{Corruptions: []CorruptionRule{{Mode: tc.mode}}})
+			postBody(t, s.Backend, "<y1@test>", lines)
+			postBody(t, s.Backend, "<plain@test>", []string{".not yEnc", "text"})
+
+			c := dial(t, s)
+			c.check("222", "BODY <y1@test>")
+			got := c.block()
+			if slices.Equal(got, lines) {
+				t.Fatal("body unchanged")
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+
+			// Only BODY damages articles, and only yEnc ones
+			c.check("220", "ARTICLE <y1@test>")
+			if got := c.block(); !slices.Equal(got[len(got)-len(lines):], lines) {
+				t.Errorf("ARTICLE body changed to %q", got)
+			}
+			c.check("222", "BODY <plain@test>")
+			if got := c.block(); !slices.Equal(got, []string{".not yEnc", "text"}) {
+				t.Errorf("non-yEnc body changed to %q", got)
+			}
+		})
+	}
+
+	if _, err := NewServerWithConfig(Config{
+		Backend:     MemoryBackendType,
+		Corruptions: []CorruptionRule{{Mode: "shuffle"}},
+	}); err == nil {
+		t.Error("unknown corruption mode accepted")
+	}
+}
+
+func TestCorruptionMatching(t *testing.T) {
+	_, lines := yencPart(t)
+
+	s := startServer(t, Config{Corruptions: []CorruptionRule{
+		{Mode: CorruptMissingYEnd, MessageIDs: []string{"y1@test", "<y2@test>"}},
+	}})
+	for i := 1; i <= 3; i++ {
+		postBody(t, s.Backend, fmt.Sprintf("<y%d@test>", i), lines)
+	}
+
+	c := dial(t, s)
+	for i, want := range []bool{true, true, false} {
+		c.check("222", "BODY <y%d@test>", i+1)
+		if got := !slices.Equal(c.block(), lines); got != want {
+			t.Errorf("<y%d@test>: damaged %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestCorruptionProbability(t *testing.T) {
+	_, lines := yencPart(t)
+
+	for _, tc := range []struct {
+		probability float64
+		low, high   int
+	}{
+		{0, 100, 100},
+		{1, 100, 100},
+		{0.3, 15, 45},
+	} {
+		t.Run(strconv.FormatFloat(tc.probability, 'f', -1, 64), func(t *testing.T) {
+			s := startServer(t, Config{
+				Corruptions: []CorruptionRule{{Mode: CorruptPCRC32, Probability: tc.probability}},
+				FaultSeed:   1,
+			})
+			postBody(t, s.Backend, "<y1@test>", lines)
+
+			c := dial(t, s)
+			damaged := 0
+			for range 100 {
+				c.check("222", "BODY <y1@test>")
+				if !slices.Equal(c.block(), lines) {
+					damaged++
+				}
+			}
+			if damaged < tc.low || damaged > tc.high {
+				t.Errorf("%d of 100 bodies damaged, want %d-%d", damaged, tc.low, tc.high)
+			}
+		})
+	}
+}
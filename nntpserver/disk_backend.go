@@ -3,18 +3,22 @@ package nntpserver
 import (
 	"bytes"
 	"encoding/gob"
-	"io"
+	"fmt"
 	"net/textproto"
 	"os"
 	"strconv"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/gofiber/storage/bbolt"
+	bolt "go.etcd.io/bbolt"
 )
 
 const (
-	DefaultDBPath    = "nntp.db"
-	ArticleNumberKey = "article_number"
+	DefaultDBPath = "nntp.db"
+	// GroupIndexKey prefixes the keys holding the group indexes
+	GroupIndexKey = "group_index"
+	DefaultGroup  = "test"
 )
 
 type backendArticle struct {
@@ -23,28 +27,22 @@ type backendArticle struct {
 	Body   []byte
 	Bytes  int
 	Lines  int
+	Groups map[string]int64 // article number in each group
+
+	Arrived time.Time
 }
 
 type DiskBackend struct {
+	*groupStore
 	db           *bbolt.Storage
-	groups       map[string]*Group
-	mu           sync.RWMutex
 	cleanOnClose bool
 	dbPath       string
-	articleCount int64 // cached in memory to avoid extra db write
 }
 
 func NewDiskBackend(
 	cleanOnClose bool,
 	dbPath string,
 ) *DiskBackend {
-	testGroup := Group{
-		Name:        "test",
-		Description: "A test group",
-		Low:         1,
-		Posting:     PostingPermitted,
-	}
-
 	if dbPath == "" {
 		dbPath = DefaultDBPath
 	}
@@ -59,70 +57,54 @@ func NewDiskBackend(
 	store.Conn().NoSync = true
 	store.Conn().NoFreelistSync = true
 
-	// Load article count from disk
-	var articleCount int64
-	artCount, err := store.Get(ArticleNumberKey)
-	if err == nil && artCount != nil {
-		articleCount, _ = strconv.ParseInt(string(artCount), 10, 64)
+	// Load group indexes from disk, they are kept in memory and every
+	// change is written through
+	storage := diskStorage{store}
+	indexes, err := storage.loadIndexes()
+	if err != nil {
+		indexes = map[string]*articleIndex{}
 	}
 
 	return &DiskBackend{
+		groupStore:   newGroupStore(storage, indexes),
 		db:           store,
-		groups:       map[string]*Group{"test": &testGroup},
 		cleanOnClose: cleanOnClose,
 		dbPath:       dbPath,
-		articleCount: articleCount,
 	}
 }
 
-func (b *DiskBackend) ListGroups(max int) ([]*Group, error) {
-	groups := make([]*Group, 0, len(b.groups))
-	for _, group := range b.groups {
-		group.Count = b.getArticleCount()
-		group.High = group.Low + group.Count - 1
-		groups = append(groups, group)
-	}
-
-	return groups, nil
+func (b *DiskBackend) Authorized() bool {
+	return true
 }
 
-func (b *DiskBackend) GetGroup(name string) (*Group, error) {
-	b.mu.RLock()
-	group := b.groups[name]
-	b.mu.RUnlock()
+// Authenticate accepts any credentials, a user database is added by
+// configuring Config.Auth.
+func (b *DiskBackend) Authenticate(user, pass string) (Backend, error) {
+	return nil, nil
+}
 
-	if group == nil {
-		b.mu.Lock()
+func (b *DiskBackend) AllowPost() bool {
+	return true
+}
 
-		b.groups[name] = &Group{
-			Name:        name,
-			Description: "A test group",
-			Low:         1,
-			Posting:     PostingPermitted,
-		}
+func (b *DiskBackend) Close() error {
+	b.retention.stopJob()
 
-		group = b.groups[name]
-		b.mu.Unlock()
+	if b.cleanOnClose {
+		_ = b.db.Reset()
+		defer os.Remove(b.dbPath)
 	}
 
-	count := b.getArticleCount()
-
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	group.Count = count
-	group.High = group.Low + group.Count - 1
-
-	return group, nil
+	return b.db.Close()
 }
 
-// GetArticle retrieves an article by message-id or article number.
-// If group is nil, only message-id lookups are supported.
-// If group is provided, both message-id and article number lookups work.
-func (b *DiskBackend) GetArticle(group *Group, id string) (*Article, error) {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
+// diskStorage keeps gob encoded articles in a bbolt database.
+type diskStorage struct {
+	db *bbolt.Storage
+}
 
-	res, _ := b.db.Get(id)
+func (d diskStorage) load(id string) (*backendArticle, error) {
+	res, _ := d.db.Get(id)
 	if res == nil {
 		return nil, ErrInvalidMessageID
 	}
@@ -131,99 +113,126 @@ func (b *DiskBackend) GetArticle(group *Group, id string) (*Article, error) {
 	if err := gob.NewDecoder(bytes.NewReader(res)).Decode(&art); err != nil {
 		return nil, err
 	}
-
-	return &Article{
-		Header: art.Header,
-		Body:   bytes.NewReader(art.Body),
-		Bytes:  art.Bytes,
-		Lines:  art.Lines,
-	}, nil
+	return &art, nil
 }
 
-func (b *DiskBackend) GetArticles(group *Group, from, to int64) ([]NumberedArticle, error) {
-	panic("not implemented")
-}
-
-func (b *DiskBackend) Authorized() bool {
-	return true
-}
-
-func (b *DiskBackend) Authenticate(user, pass string) (Backend, error) {
-	return nil, ErrAuthRejected
-}
-
-func (b *DiskBackend) AllowPost() bool {
-	return true
-}
-
-func (b *DiskBackend) Post(article *Article) error {
-	bWr := bytes.NewBuffer(nil)
-	if _, err := io.Copy(bWr, article.Body); err != nil {
-		return err
-	}
-
+func (d diskStorage) store(art *backendArticle) error {
 	// Use a more efficient binary encoding instead of JSON
 	artBuf := bytes.NewBuffer(nil)
-	enc := gob.NewEncoder(artBuf)
-	if err := enc.Encode(backendArticle{
-		Id:     article.MessageID(),
-		Header: article.Header,
-		Body:   bWr.Bytes(),
-		Bytes:  article.Bytes,
-		Lines:  article.Lines,
-	}); err != nil {
+	if err := gob.NewEncoder(artBuf).Encode(art); err != nil {
 		return err
 	}
+	return d.db.Set(art.Id, artBuf.Bytes(), 0)
+}
 
-	b.mu.Lock()
-	if err := b.db.Set(article.MessageID(), artBuf.Bytes(), 0); err != nil {
-		b.mu.Unlock()
-		return err
-	}
-	b.mu.Unlock()
+func (d diskStorage) remove(id string) error {
+	return d.db.Delete(id)
+}
 
-	bWr = nil
-	artBuf = nil
+func (d diskStorage) has(id string) (bool, error) {
+	res, err := d.db.Get(id)
+	return res != nil, err
+}
 
-	_ = b.increaseArticleCount()
+func (d diskStorage) reset() error {
+	return d.db.Reset()
+}
 
-	return nil
+// The index of a group is kept as a GroupIndexKey NUL group key holding
+// the next article number, and a key per entry that appends NUL and the
+// zero-padded article number, holding the arrival time and message-id.
+func indexKey(group string) string {
+	return GroupIndexKey + "\x00" + group
 }
 
-// Stat checks if an article exists and returns its number and id.
-// If group is nil, only message-id lookups are supported.
-func (b *DiskBackend) Stat(group *Group, id string) (string, string, error) {
-	if _, err := b.GetArticle(group, id); err != nil {
-		return "", "", err
-	}
+func entryKey(group string, num int64) string {
+	return fmt.Sprintf("%s\x00%020d", indexKey(group), num)
+}
 
-	return "1", id, nil
+func (d diskStorage) saveIndex(group string, next int64, entries ...indexEntry) error {
+	return d.update(func(b *bolt.Bucket) error {
+		for _, e := range entries {
+			value := strconv.FormatInt(e.Arrived, 10) + " " + e.Id
+			if err := b.Put([]byte(entryKey(group, e.Num)), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return b.Put([]byte(indexKey(group)), []byte(strconv.FormatInt(next, 10)))
+	})
 }
 
-func (b *DiskBackend) getArticleCount() int64 {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
-	return b.articleCount
+func (d diskStorage) removeEntries(group string, entries ...indexEntry) error {
+	return d.update(func(b *bolt.Bucket) error {
+		for _, e := range entries {
+			if err := b.Delete([]byte(entryKey(group, e.Num))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (b *DiskBackend) increaseArticleCount() int64 {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	b.articleCount++
-	return b.articleCount
+// update runs fn in a single write transaction on the storage bucket.
+func (d diskStorage) update(fn func(b *bolt.Bucket) error) error {
+	return d.db.Conn().Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket([]byte(bbolt.ConfigDefault.Bucket)))
+	})
 }
 
-func (b *DiskBackend) Close() error {
-	// Persist article count before closing
-	b.mu.RLock()
-	count := b.articleCount
-	b.mu.RUnlock()
-	_ = b.db.Set(ArticleNumberKey, []byte(strconv.FormatInt(count, 10)), 0)
+func (d diskStorage) removeIndex(group string) error {
+	return d.db.Delete(indexKey(group))
+}
 
-	if b.cleanOnClose {
-		_ = b.db.Reset()
-		defer os.Remove(b.dbPath)
+// loadIndexes reads the group indexes, converting those older versions
+// stored as one gob value under GroupIndexKey.
+func (d diskStorage) loadIndexes() (map[string]*articleIndex, error) {
+	if raw, err := d.db.Get(GroupIndexKey); err == nil && raw != nil {
+		var old map[string]*articleIndex
+		if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&old); err == nil {
+			for name, index := range old {
+				if err := d.saveIndex(name, index.Next, index.Entries...); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := d.db.Delete(GroupIndexKey); err != nil {
+			return nil, err
+		}
 	}
 
-	return b.db.Close()
+	indexes := map[string]*articleIndex{}
+	prefix := []byte(GroupIndexKey + "\x00")
+	err := d.db.Conn().View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(bbolt.ConfigDefault.Bucket)).Cursor()
+		// Entries follow their group key in ascending number order
+		for k, v := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			group, num, isEntry := strings.Cut(string(k[len(prefix):]), "\x00")
+			index := indexes[group]
+			if index == nil {
+				index = newArticleIndex()
+				indexes[group] = index
+			}
+
+			if !isEntry {
+				next, err := strconv.ParseInt(string(v), 10, 64)
+				if err != nil {
+					return err
+				}
+				index.Next = max(index.Next, next)
+				continue
+			}
+			n, err := strconv.ParseInt(num, 10, 64)
+			if err != nil {
+				return err
+			}
+			arrived, id, _ := strings.Cut(string(v), " ")
+			a, err := strconv.ParseInt(arrived, 10, 64)
+			if err != nil {
+				return err
+			}
+			index.insert(n, id, a)
+		}
+		return nil
+	})
+	return indexes, err
 }
@@ -0,0 +1,151 @@
+package nntpserver
+
+import (
+	"bytes"
+	"encoding/gob"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// killDisk closes the database of b without closing b, like a process
+// that is killed.
+func killDisk(t *testing.T, b *DiskBackend) {
+	t.Helper()
+	b.retention.stopJob()
+	if err := b.db.Close(); err != nil {
+		t.Fatalf("closing the database: %v", err)
+	}
+}
+
+func numbers(t *testing.T, b Backend, group string) []int64 {
+	t.Helper()
+	g, err := b.GetGroup(group)
+	if err != nil {
+		t.Fatalf("GetGroup(%s): %v", group, err)
+	}
+	nums, err := articleNumbers(b, g, 0, 1<<62)
+	if err != nil {
+		t.Fatalf("articleNumbers(%s): %v", group, err)
+	}
+	return nums
+}
+
+func TestDiskIndexSurvivesKill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nntp.db")
+
+	b := NewDiskBackend(false, path)
+	postArticles(t, b, "foo", "<a1@test>", "<a2@test>", "<a3@test>")
+	postArticles(t, b, "bar", "<b1@test>")
+	if err := b.DeleteArticle("<a3@test>"); err != nil {
+		t.Fatalf("DeleteArticle: %v", err)
+	}
+	if _, err := b.CreateGroup("empty", ""); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	killDisk(t, b)
+
+	b = NewDiskBackend(true, path)
+	defer b.Close()
+	if got := numbers(t, b, "foo"); !slices.Equal(got, []int64{1, 2}) {
+		t.Errorf("foo: got articles %v, want [1 2]", got)
+	}
+	if got := numbers(t, b, "bar"); !slices.Equal(got, []int64{1}) {
+		t.Errorf("bar: got articles %v, want [1]", got)
+	}
+	if _, err := b.CreateGroup("empty", ""); err != ErrGroupExists {
+		t.Errorf("empty group lost: CreateGroup got %v", err)
+	}
+
+	// Numbers already handed out are not reused
+	postArticles(t, b, "foo", "<a4@test>")
+	if got := numbers(t, b, "foo"); !slices.Equal(got, []int64{1, 2, 4}) {
+		t.Errorf("foo after posting: got articles %v, want [1 2 4]", got)
+	}
+	article, err := b.GetArticle(&Group{Name: "foo"}, "2")
+	if err != nil || article.MessageID() != "<a2@test>" {
+		t.Errorf("GetArticle(foo, 2): got %v, %v", article, err)
+	}
+}
+
+func TestDiskIndexDeleteGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nntp.db")
+
+	b := NewDiskBackend(false, path)
+	postArticles(t, b, "foo", "<a1@test>", "<a2@test>")
+	if err := b.DeleteGroup("foo"); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	killDisk(t, b)
+
+	b = NewDiskBackend(true, path)
+	defer b.Close()
+	if _, err := b.CreateGroup("foo", ""); err != nil {
+		t.Errorf("deleted group came back: CreateGroup got %v", err)
+	}
+}
+
+func TestDiskIndexExpire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nntp.db")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	b := NewDiskBackend(false, path)
+	b.SetClock(clock)
+	postArticles(t, b, "foo", "<old@test>")
+	now = now.Add(time.Hour)
+	postArticles(t, b, "foo", "<new@test>")
+	b.SetRetention(30*time.Minute, time.Hour)
+	if n, err := b.Expire(); err != nil || n != 1 {
+		t.Fatalf("Expire: got %d, %v, want 1 article", n, err)
+	}
+	killDisk(t, b)
+
+	b = NewDiskBackend(true, path)
+	defer b.Close()
+	if got := numbers(t, b, "foo"); !slices.Equal(got, []int64{2}) {
+		t.Errorf("foo: got articles %v, want [2]", got)
+	}
+	if ok, _ := b.HasArticle("<old@test>"); ok {
+		t.Error("expired article still stored")
+	}
+}
+
+func TestDiskIndexOldFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nntp.db")
+
+	b := NewDiskBackend(false, path)
+	postArticles(t, b, "foo", "<a1@test>", "<a2@test>")
+	// Older versions kept every index in one gob value
+	old := map[string]*articleIndex{"foo": {
+		Entries: []indexEntry{{Num: 1, Id: "<a1@test>"}, {Num: 2, Id: "<a2@test>"}},
+		Next:    5,
+	}}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(old); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.db.Set(GroupIndexKey, buf.Bytes(), 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{entryKey("foo", 1), entryKey("foo", 2), indexKey("foo")} {
+		if err := b.db.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	killDisk(t, b)
+
+	b = NewDiskBackend(true, path)
+	defer b.Close()
+	if got := numbers(t, b, "foo"); !slices.Equal(got, []int64{1, 2}) {
+		t.Errorf("foo: got articles %v, want [1 2]", got)
+	}
+	if raw, _ := b.db.Get(GroupIndexKey); raw != nil {
+		t.Error("old index left in place")
+	}
+	postArticles(t, b, "foo", "<a5@test>")
+	if got := numbers(t, b, "foo"); !slices.Equal(got, []int64{1, 2, 5}) {
+		t.Errorf("foo after posting: got articles %v, want [1 2 5]", got)
+	}
+}
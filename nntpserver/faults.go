@@ -0,0 +1,298 @@
+package nntpserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errFaultDropped = errors.New("connection dropped by fault injection")
+
+// DefaultFaultCode is the response code of injected errors whose rule
+// gives none.
+const DefaultFaultCode = 503
+
+// FaultRule describes a fault injected into the commands it matches.
+type FaultRule struct {
+	// Command verb the rule applies to (case-insensitive), "" or "*" for all
+	Command string `yaml:"command"`
+	// Fixed delay before the command runs
+	Delay time.Duration `yaml:"delay"`
+	// Upper bound of a random delay added to Delay
+	Jitter time.Duration `yaml:"jitter"`
+	// Probability (0-1) of answering with ErrorCode (DefaultFaultCode if 0)
+	// instead of running the command
+	ErrorProbability float64 `yaml:"error_probability"`
+	ErrorCode        int     `yaml:"error_code"`
+	// Text of the injected error (defaults to "Injected fault")
+	ErrorMessage string `yaml:"error_message"`
+	// Probability (0-1) of closing the connection after DropAfter bytes
+	// of the response
+	DropProbability float64 `yaml:"drop_probability"`
+	DropAfter       int     `yaml:"drop_after"`
+	// Probability (0-1) of cutting a multi-line response before its
+	// terminating dot and closing the connection. A TruncateAfter above
+	// zero also cuts the body after that many bytes.
+	TruncateProbability float64 `yaml:"truncate_probability"`
+	TruncateAfter       int     `yaml:"truncate_after"`
+}
+
+func (r *FaultRule) matches(cmd string) bool {
+	return r.Command == "" || r.Command == "*" || strings.EqualFold(r.Command, cmd)
+}
+
+func (r *FaultRule) validate() error {
+	for name, p := range map[string]float64{
+		"error_probability":    r.ErrorProbability,
+		"drop_probability":     r.DropProbability,
+		"truncate_probability": r.TruncateProbability,
+	} {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("%s %v is not between 0 and 1", name, p)
+		}
+	}
+	for name, d := range map[string]time.Duration{"delay": r.Delay, "jitter": r.Jitter} {
+		if d < 0 {
+			return fmt.Errorf("negative %s %v", name, d)
+		}
+	}
+	if r.DropAfter < 0 || r.TruncateAfter < 0 {
+		return errors.New("negative drop_after or truncate_after")
+	}
+	if r.ErrorCode != 0 && (r.ErrorCode < 100 || r.ErrorCode > 599) {
+		return fmt.Errorf("error_code %d is not a response code", r.ErrorCode)
+	}
+	return nil
+}
+
+// validateFaultRules reports the first invalid rule of rules.
+func validateFaultRules(rules []FaultRule) error {
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return fmt.Errorf("fault rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// faultInjector holds the fault rules of a server. They may be replaced
+// while sessions are running.
+type faultInjector struct {
+	mu    sync.Mutex
+	rules []FaultRule
+	rand  *rand.Rand
+}
+
+func newFaultInjector(rules []FaultRule, seed int64) *faultInjector {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &faultInjector{
+		rules: rules,
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (f *faultInjector) setRules(rules []FaultRule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append([]FaultRule(nil), rules...)
+}
+
+func (f *faultInjector) getRules() []FaultRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FaultRule(nil), f.rules...)
+}
+
+// faultAction is the outcome of rolling the dice for one command.
+type faultAction struct {
+	delay    time.Duration
+	err      *NNTPError
+	drop     bool
+	dropAt   int
+	truncate bool
+	cutAt    int
+}
+
+// roll picks the action for cmd from the first matching rule.
+func (f *faultInjector) roll(cmd string) faultAction {
+	var action faultAction
+	if f == nil {
+		return action
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, r := range f.rules {
+		if !r.matches(cmd) {
+			continue
+		}
+
+		action.delay = r.Delay
+		if r.Jitter > 0 {
+			action.delay += time.Duration(f.rand.Int63n(int64(r.Jitter)))
+		}
+
+		switch {
+		case r.ErrorProbability > 0 && f.rand.Float64() < r.ErrorProbability:
+			msg := r.ErrorMessage
+			if msg == "" {
+				msg = "Injected fault"
+			}
+			code := r.ErrorCode
+			if code == 0 {
+				code = DefaultFaultCode
+			}
+			action.err = &NNTPError{code, msg}
+		case r.DropProbability > 0 && f.rand.Float64() < r.DropProbability:
+			action.drop = true
+			action.dropAt = r.DropAfter
+		case r.TruncateProbability > 0 && f.rand.Float64() < r.TruncateProbability:
+			action.truncate = true
+			action.cutAt = r.TruncateAfter
+		}
+		break
+	}
+
+	return action
+}
+
+// SetFaultRules replaces the fault rules; sessions pick them up with their
+// next command. The rules are left unchanged if one is invalid.
+func (s *Server) SetFaultRules(rules []FaultRule) error {
+	if err := validateFaultRules(rules); err != nil {
+		return err
+	}
+	s.faults.setRules(rules)
+	return nil
+}
+
+// FaultRules returns a copy of the current fault rules.
+func (s *Server) FaultRules() []FaultRule {
+	return s.faults.getRules()
+}
+
+var dotTerminator = []byte(".\r\n")
+
+// faultConn sits between a session and its connection so a response can be
+// cut short. It passes everything through until armed.
+type faultConn struct {
+	net.Conn
+
+	drop     bool
+	left     int // bytes the response may still write before a drop
+	truncate bool
+	cutAt    int    // body bytes allowed when truncating, 0 for all
+	inBody   bool   // the status line has been written
+	body     int    // body bytes written so far
+	hold     []byte // tail withheld in case it is the terminating dot
+	dropped  bool
+}
+
+func (fc *faultConn) arm(action faultAction) {
+	fc.drop, fc.left = action.drop, action.dropAt
+	fc.truncate, fc.cutAt = action.truncate, action.cutAt
+	fc.inBody, fc.body, fc.hold = false, 0, nil
+}
+
+// finish ends an armed command, closing the connection if a fault fired.
+func (fc *faultConn) finish() error {
+	defer fc.arm(faultAction{})
+
+	switch {
+	case fc.dropped:
+		return errFaultDropped
+	case fc.drop:
+		fc.Conn.Close()
+		return errFaultDropped
+	case fc.truncate && bytes.Equal(fc.hold, dotTerminator):
+		// Multi-line response: leave the dot out and hang up
+		fc.Conn.Close()
+		return errFaultDropped
+	case len(fc.hold) > 0:
+		_, err := fc.Conn.Write(fc.hold)
+		return err
+	}
+	return nil
+}
+
+func (fc *faultConn) Read(p []byte) (int, error) {
+	// Intermediate replies such as 340 must reach the client before it sends more
+	if len(fc.hold) > 0 {
+		hold := fc.hold
+		fc.hold = nil
+		if _, err := fc.Conn.Write(hold); err != nil {
+			return 0, err
+		}
+	}
+	return fc.Conn.Read(p)
+}
+
+func (fc *faultConn) Write(p []byte) (int, error) {
+	switch {
+	case fc.dropped:
+		return 0, errFaultDropped
+	case fc.drop:
+		return fc.writeDrop(p)
+	case fc.truncate:
+		return fc.writeTruncate(p)
+	}
+	return fc.Conn.Write(p)
+}
+
+func (fc *faultConn) writeDrop(p []byte) (int, error) {
+	if len(p) <= fc.left {
+		fc.left -= len(p)
+		return fc.Conn.Write(p)
+	}
+
+	fc.Conn.Write(p[:fc.left])
+	fc.Conn.Close()
+	fc.dropped = true
+	return 0, errFaultDropped
+}
+
+func (fc *faultConn) writeTruncate(p []byte) (int, error) {
+	buf := append(fc.hold, p...)
+	fc.hold = nil
+
+	var out []byte
+	if !fc.inBody {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			_, err := fc.Conn.Write(buf)
+			return len(p), err
+		}
+		out, buf = buf[:i+1], buf[i+1:]
+		fc.inBody = true
+	}
+
+	if fc.cutAt > 0 && fc.body+len(buf) > fc.cutAt {
+		out = append(out, buf[:fc.cutAt-fc.body]...)
+		fc.Conn.Write(out)
+		fc.Conn.Close()
+		fc.dropped = true
+		return 0, errFaultDropped
+	}
+
+	// Withhold what could be the start of the terminating dot
+	keep := len(buf) - len(dotTerminator)
+	if keep < 0 {
+		keep = 0
+	}
+	out = append(out, buf[:keep]...)
+	fc.hold = append([]byte(nil), buf[keep:]...)
+	fc.body += keep
+
+	if _, err := fc.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,170 @@
+package nntpserver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rest reads what the server sends until it closes the connection.
+func (c *client) rest() string {
+	c.t.Helper()
+	data, err := io.ReadAll(c.R)
+	if err != nil {
+		c.t.Fatalf("reading until the connection closes: %v", err)
+	}
+	return string(data)
+}
+
+func TestFaults(t *testing.T) {
+	const body = "222 1 <a1@test>\r\nline one\r\nline two\r\n.\r\n"
+
+	for _, tc := range []struct {
+		name string
+		rule FaultRule
+		// Response to BODY 1, which ends with the connection unless open
+		want string
+		open bool
+	}{
+		{
+			name: "none",
+			rule: FaultRule{Command: "stat", ErrorProbability: 1},
+			want: body,
+			open: true,
+		},
+		{
+			name: "error",
+			rule: FaultRule{Command: "BODY", ErrorProbability: 1, ErrorCode: 430, ErrorMessage: "Gone"},
+			want: "430 Gone\r\n",
+			open: true,
+		},
+		{
+			name: "default error",
+			rule: FaultRule{Command: "body", ErrorProbability: 1},
+			want: "503 Injected fault\r\n",
+			open: true,
+		},
+		{
+			name: "drop",
+			rule: FaultRule{Command: "body", DropProbability: 1, DropAfter: 20},
+			want: body[:20],
+		},
+		{
+			name: "drop at once",
+			rule: FaultRule{DropProbability: 1},
+			want: "",
+		},
+		{
+			name: "truncate",
+			rule: FaultRule{Command: "body", TruncateProbability: 1},
+			want: strings.TrimSuffix(body, ".\r\n"),
+		},
+		{
+			name: "truncate body",
+			rule: FaultRule{Command: "body", TruncateProbability: 1, TruncateAfter: 5},
+			want: "222 1 <a1@test>\r\nline ",
+		},
+		{
+			name: "never",
+			rule: FaultRule{Command: "body", ErrorProbability: 0, DropProbability: 0},
+			want: body,
+			open: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := startServer(t, Config{Faults: []FaultRule{tc.rule}})
+			postArticles(t, s.Backend, "foo", "<a1@test>")
+
+			c := dial(t, s)
+			if err := c.PrintfLine("BODY <a1@test>"); err != nil {
+				t.Fatal(err)
+			}
+			// Articles fetched by message-id are numbered 0
+			want := strings.Replace(tc.want, "222 1", "222 0", 1)
+			if tc.open {
+				got := c.line() + "\r\n"
+				if strings.HasPrefix(got, "222") {
+					got += strings.Join(c.block(), "\r\n") + "\r\n.\r\n"
+				}
+				if got != want {
+					t.Errorf("got %q, want %q", got, want)
+				}
+				c.check("205", "QUIT")
+				return
+			}
+			if got := c.rest(); got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFaultDelay(t *testing.T) {
+	s := startServer(t, Config{Faults: []FaultRule{
+		{Command: "group", Delay: 50 * time.Millisecond, Jitter: 20 * time.Millisecond},
+	}})
+
+	c := dial(t, s)
+	for range 3 {
+		start := time.Now()
+		c.check("211", "GROUP foo")
+		if took := time.Since(start); took < 50*time.Millisecond || took > time.Second {
+			t.Errorf("GROUP took %v, want 50-70ms", took)
+		}
+	}
+
+	start := time.Now()
+	c.capabilities()
+	if took := time.Since(start); took >= 50*time.Millisecond {
+		t.Errorf("CAPABILITIES delayed by %v", took)
+	}
+}
+
+func TestFaultRuleValidation(t *testing.T) {
+	valid := []FaultRule{{Command: "group", ErrorProbability: 1}}
+
+	for _, tc := range []struct {
+		name string
+		rule FaultRule
+	}{
+		{"error probability", FaultRule{ErrorProbability: 1.5}},
+		{"negative probability", FaultRule{DropProbability: -0.1}},
+		{"truncate probability", FaultRule{TruncateProbability: 2}},
+		{"negative delay", FaultRule{Delay: -time.Second}},
+		{"negative jitter", FaultRule{Jitter: -time.Second}},
+		{"negative drop_after", FaultRule{DropProbability: 1, DropAfter: -1}},
+		{"bad code", FaultRule{ErrorProbability: 1, ErrorCode: 42}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rules := []FaultRule{valid[0], tc.rule}
+			if _, err := NewServerWithConfig(Config{Backend: MemoryBackendType, Faults: rules}); err == nil {
+				t.Error("NewServerWithConfig accepted the rule")
+			}
+
+			s := startServer(t, Config{Faults: valid})
+			if err := s.SetFaultRules(rules); err == nil {
+				t.Error("SetFaultRules accepted the rule")
+			}
+			if got := s.FaultRules(); len(got) != 1 || got[0] != valid[0] {
+				t.Errorf("rules changed to %+v", got)
+			}
+
+			data, err := yaml.Marshal(rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodPut, "/faults", bytes.NewReader(data))
+			rec := httptest.NewRecorder()
+			s.AdminHandler().ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("PUT /faults: got %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package nntpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fixtureManifest is the layout of a JSON fixture file.
+type fixtureManifest struct {
+	Articles []fixtureArticle `json:"articles"`
+}
+
+// fixtureArticle is either a reference to a message file, an article
+// spelled out in the manifest or a binary file to post yEnc encoded.
+// Paths are relative to the manifest.
+type fixtureArticle struct {
+	File      string            `json:"file"`
+	MessageID string            `json:"message_id"`
+	Groups    []string          `json:"newsgroups"`
+	Numbers   map[string]int64  `json:"numbers"`
+	Headers   map[string]string `json:"headers"`
+	Body      string            `json:"body"`
+	BodyFile  string            `json:"body_file"`
+
+	Binary     string   `json:"binary"`
+	PartSize   int      `json:"part_size"`
+	LineLength int      `json:"line_length"`
+	MessageIDs []string `json:"message_ids"`
+}
+
+// LoadFixtures posts the articles stored at path to backend and returns how
+// many were posted. Articles already stored are skipped. path may be a
+// directory of .eml files (posted in name order), a .json manifest or an
+// mbox file.
+//
+// Articles are filed under the groups of their Newsgroups header. An Xref
+// header pins their numbers, otherwise they are numbered in posting order.
+func LoadFixtures(backend Backend, path string) (int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("loading fixtures: %w", err)
+	}
+
+	var articles []*Article
+	switch {
+	case info.IsDir():
+		articles, err = readMessageDir(path)
+	case strings.EqualFold(filepath.Ext(path), ".json"):
+		articles, err = readManifest(path)
+	default:
+		articles, err = readMbox(path)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("loading fixtures from %s: %w", path, err)
+	}
+
+	posted := 0
+	for i, article := range articles {
+		if article.MessageID() == "" {
+			return posted, fmt.Errorf("loading fixtures from %s: article %d has no Message-Id", path, i+1)
+		}
+		err := backend.Post(article)
+		if err == ErrDuplicateArticle {
+			// Already loaded into a persistent database
+			continue
+		}
+		if err != nil {
+			return posted, fmt.Errorf("loading fixtures from %s: posting %s: %w", path, article.MessageID(), err)
+		}
+		posted++
+	}
+
+	return posted, nil
+}
+
+func readMessageDir(dir string) ([]*Article, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	articles := make([]*Article, 0, len(paths))
+	for _, p := range paths {
+		article, err := readMessageFile(p)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+	return articles, nil
+}
+
+func readMessageFile(path string) (*Article, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	article, err := parseMessage(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return article, nil
+}
+
+// parseMessage splits a RFC 5322 message into an article. Line endings
+// are normalized to LF, the server adds CRs when sending.
+func parseMessage(data []byte) (*Article, error) {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	r := bufio.NewReader(bytes.NewReader(data))
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	body := new(bytes.Buffer)
+	if _, err := r.WriteTo(body); err != nil {
+		return nil, err
+	}
+
+	return &Article{Header: header, Body: body}, nil
+}
+
+// mboxFromLine matches the From_ lines of mboxrd files that were quoted to
+// keep them from starting a new message.
+var mboxFromLine = regexp.MustCompile(`(?m)^>(>*From )`)
+
+// readMbox splits an mbox file on its "From " separator lines.
+func readMbox(path string) ([]*Article, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	var messages [][]byte
+	var current []byte
+	blank := true
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if blank && bytes.HasPrefix(line, []byte("From ")) {
+			if current != nil {
+				messages = append(messages, current)
+			}
+			current = []byte{}
+			continue
+		}
+		if current != nil {
+			current = append(current, line...)
+		}
+		blank = len(bytes.TrimRight(line, "\n")) == 0
+	}
+	if current != nil {
+		messages = append(messages, current)
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no messages found")
+	}
+
+	articles := make([]*Article, 0, len(messages))
+	for i, msg := range messages {
+		// The blank line before the next separator belongs to the mbox
+		if bytes.HasSuffix(msg, []byte("\n\n")) {
+			msg = msg[:len(msg)-1]
+		}
+		article, err := parseMessage(mboxFromLine.ReplaceAll(msg, []byte("$1")))
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+		articles = append(articles, article)
+	}
+	return articles, nil
+}
+
+func readManifest(path string) ([]*Article, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest fixtureManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+	articles := make([]*Article, 0, len(manifest.Articles))
+	for i, fa := range manifest.Articles {
+		if fa.Binary != "" {
+			binary, err := fa.binaryArticles(dir)
+			if err != nil {
+				return nil, fmt.Errorf("article %d: %w", i+1, err)
+			}
+			articles = append(articles, binary...)
+			continue
+		}
+
+		article, err := fa.article(dir)
+		if err != nil {
+			return nil, fmt.Errorf("article %d: %w", i+1, err)
+		}
+		articles = append(articles, article)
+	}
+	return articles, nil
+}
+
+// article builds the article described by fa. Fields set in the manifest
+// override the headers of a referenced file.
+func (fa *fixtureArticle) article(dir string) (*Article, error) {
+	article := &Article{Header: textproto.MIMEHeader{}, Body: new(bytes.Buffer)}
+	if fa.File != "" {
+		var err error
+		if article, err = readMessageFile(filepath.Join(dir, fa.File)); err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range fa.Headers {
+		article.Header.Set(k, v)
+	}
+	if fa.MessageID != "" {
+		article.Header.Set("Message-Id", fa.MessageID)
+	}
+	if len(fa.Groups) > 0 {
+		article.Header.Set("Newsgroups", strings.Join(fa.Groups, ","))
+	}
+	if len(fa.Numbers) > 0 {
+		names := make([]string, 0, len(fa.Numbers))
+		for name := range fa.Numbers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		xref := []string{"fixtures"}
+		for _, name := range names {
+			xref = append(xref, name+":"+strconv.FormatInt(fa.Numbers[name], 10))
+		}
+		article.Header.Set("Xref", strings.Join(xref, " "))
+	}
+
+	switch {
+	case fa.BodyFile != "":
+		body, err := os.ReadFile(filepath.Join(dir, fa.BodyFile))
+		if err != nil {
+			return nil, err
+		}
+		article.Body = bytes.NewReader(bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n")))
+	case fa.Body != "":
+		article.Body = strings.NewReader(fa.Body)
+	}
+
+	return article, nil
+}
+
+// binaryArticles returns the yEnc articles of a binary entry.
+func (fa *fixtureArticle) binaryArticles(dir string) ([]*Article, error) {
+	data, err := os.ReadFile(filepath.Join(dir, fa.Binary))
+	if err != nil {
+		return nil, err
+	}
+
+	post := BinaryPost{
+		Name:       filepath.Base(fa.Binary),
+		Data:       data,
+		PartSize:   fa.PartSize,
+		LineLength: fa.LineLength,
+		Groups:     fa.Groups,
+		From:       fa.Headers["From"],
+		MessageIDs: fa.MessageIDs,
+	}
+	return post.articles()
+}
@@ -0,0 +1,107 @@
+package nntpserver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadFixtures(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"testdata/fixtures/articles.mbox", 2},
+		{"testdata/fixtures/messages", 2},
+		{"testdata/fixtures/manifest.json", 4},
+	} {
+		t.Run(filepath.Base(tc.path), func(t *testing.T) {
+			b := NewMemoryBackend()
+			defer b.Close()
+
+			if n, err := LoadFixtures(b, tc.path); err != nil || n != tc.want {
+				t.Fatalf("LoadFixtures: got %d, %v, want %d articles", n, err, tc.want)
+			}
+			// Loading again skips what is stored
+			if n, err := LoadFixtures(b, tc.path); err != nil || n != 0 {
+				t.Errorf("loading again: got %d, %v, want 0 articles", n, err)
+			}
+		})
+	}
+
+	if _, err := LoadFixtures(NewMemoryBackend(), "testdata/fixtures/none.mbox"); err == nil {
+		t.Error("LoadFixtures accepted a missing file")
+	}
+}
+
+func TestFixtureArticles(t *testing.T) {
+	s := startServer(t, Config{Fixtures: []string{
+		"testdata/fixtures/articles.mbox",
+		"testdata/fixtures/messages",
+		"testdata/fixtures/manifest.json",
+	}})
+
+	c := dial(t, s)
+	for _, tc := range []struct {
+		cmd  string
+		want []string
+	}{
+		// Only the quoting of From_ lines at the start of a line is undone
+		{"BODY <m1@test>", []string{
+			"From the start",
+			">From quoted twice",
+			"From after a text line is no separator",
+			" >From not at the start",
+		}},
+		{"BODY <m2@test>", []string{"body two"}},
+		{"BODY <e2@test>", []string{"body two"}},
+		{"BODY <j1@test>", []string{"body one"}},
+		{"BODY <j2@test>", []string{"inline body"}},
+	} {
+		c.check("222", tc.cmd)
+		if got := c.block(); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.cmd, got, tc.want)
+		}
+	}
+
+	// Xref headers and manifest numbers pin article numbers
+	for _, tc := range []struct {
+		group, status string
+		articles      []string // number and message-id
+	}{
+		{"mbox.test", "211 2 1 7", []string{"1 <m1@test>", "7 <m2@test>"}},
+		{"dir.test", "211 2 1 5", []string{"1 <e1@test>", "5 <e2@test>"}},
+		{"other.test", "211 1 2 2", []string{"2 <e2@test>"}},
+		{"json.test", "211 2 3 4", []string{"3 <j1@test>", "4 <j2@test>"}},
+		{"bin.test", "211 2 1 2", []string{"1 <b1@test>", "2 <b2@test>"}},
+	} {
+		c.check(tc.status, "GROUP %s", tc.group)
+		for _, a := range tc.articles {
+			num, _, _ := strings.Cut(a, " ")
+			c.check("223 "+a, "STAT %s", num)
+		}
+	}
+
+	c.check("221", "HEAD <j2@test>")
+	if !slices.Contains(c.block(), "Subject: inline") {
+		t.Error("manifest header not set")
+	}
+
+	// Binary entries are posted yEnc encoded in parts
+	want, err := os.ReadFile("testdata/fixtures/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for _, id := range []string{"<b1@test>", "<b2@test>"} {
+		c.check("222", "BODY %s", id)
+		// Without the =ypart line
+		got = append(got, yencData(t, slices.Delete(c.block(), 1, 2))...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("binary parts hold %x, want %x", got, want)
+	}
+}
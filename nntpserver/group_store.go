@@ -0,0 +1,463 @@
+package nntpserver
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// articleStorage keeps the articles of a groupStore by message-id. The
+// groupStore lock is held for every call.
+type articleStorage interface {
+	// load returns the article stored under id, ErrInvalidMessageID if
+	// there is none. Callers may change the copy they get.
+	load(id string) (*backendArticle, error)
+	store(art *backendArticle) error
+	remove(id string) error
+	has(id string) (bool, error)
+	// reset drops every article.
+	reset() error
+	// saveIndex records the next article number of group and entries
+	// added to its index, for storage that outlives the process.
+	saveIndex(group string, next int64, entries ...indexEntry) error
+	// removeEntries drops entries from the recorded index of group.
+	removeEntries(group string, entries ...indexEntry) error
+	// removeIndex drops the record of group, whose entries must have been
+	// removed.
+	removeIndex(group string) error
+}
+
+// groupStore implements the group, numbering and retention side of the
+// backends on top of an articleStorage.
+type groupStore struct {
+	mu        sync.RWMutex
+	groups    map[string]*Group
+	indexes   map[string]*articleIndex
+	retention retention
+	storage   articleStorage
+}
+
+// newGroupStore returns a store holding DefaultGroup and a group for every
+// one of indexes, which may be nil.
+func newGroupStore(storage articleStorage, indexes map[string]*articleIndex) *groupStore {
+	if indexes == nil {
+		indexes = map[string]*articleIndex{}
+	}
+	b := &groupStore{
+		groups:  map[string]*Group{},
+		indexes: indexes,
+		storage: storage,
+	}
+
+	b.ensureGroup(DefaultGroup)
+	for name := range indexes {
+		b.ensureGroup(name)
+	}
+	return b
+}
+
+func newGroup(name string) *Group {
+	return &Group{
+		Name:        name,
+		Description: "A test group",
+		Low:         1,
+		Posting:     PostingPermitted,
+	}
+}
+
+// ensureGroup returns the named group, creating it and its index if needed.
+// Callers must hold b.mu.
+func (b *groupStore) ensureGroup(name string) *Group {
+	group := b.groups[name]
+	if group == nil {
+		group = newGroup(name)
+		b.groups[name] = group
+	}
+	if b.indexes[name] == nil {
+		b.indexes[name] = newArticleIndex()
+	}
+	return group
+}
+
+func (b *groupStore) ListGroups(max int) ([]*Group, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	groups := make([]*Group, 0, len(b.groups))
+	for _, group := range b.groups {
+		b.updateGroup(group)
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+func (b *groupStore) GetGroup(name string) (*Group, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group := b.ensureGroup(name)
+	b.updateGroup(group)
+
+	return group, nil
+}
+
+// updateGroup refreshes the group water marks from its article index.
+// Callers must hold b.mu.
+func (b *groupStore) updateGroup(group *Group) {
+	index := b.indexes[group.Name]
+	group.Count, group.Low, group.High = index.summary(b.retention.cutoff())
+}
+
+// GetArticle retrieves an article by message-id or article number.
+// If group is nil, only message-id lookups are supported.
+// If group is provided, both message-id and article number lookups work
+// and the returned article carries its number in that group.
+func (b *groupStore) GetArticle(group *Group, id string) (*Article, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if strings.HasPrefix(id, "<") {
+		return b.loadArticle(group, id)
+	}
+
+	if group == nil {
+		return nil, ErrNoGroupSelected
+	}
+	if id == "" {
+		return nil, ErrNoCurrentArticle
+	}
+
+	num, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrSyntax
+	}
+	// The group may have been deleted since the session selected it
+	index := b.indexes[group.Name]
+	if index == nil {
+		return nil, ErrNoSuchGroup
+	}
+	msgID, ok := index.get(num)
+	if !ok {
+		return nil, ErrInvalidArticleNumber
+	}
+
+	article, err := b.loadArticle(group, msgID)
+	if err == ErrInvalidMessageID {
+		return nil, ErrInvalidArticleNumber
+	}
+	return article, err
+}
+
+// GetArticles returns the articles numbered from..to, inclusive, in order.
+func (b *groupStore) GetArticles(group *Group, from, to int64) ([]NumberedArticle, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	index := b.indexes[group.Name]
+	if index == nil {
+		return nil, ErrNoSuchGroup
+	}
+
+	entries := index.between(from, to)
+	articles := make([]NumberedArticle, 0, len(entries))
+	for _, e := range entries {
+		article, err := b.loadArticle(group, e.Id)
+		if err == ErrInvalidMessageID {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, NumberedArticle{Num: e.Num, Article: article})
+	}
+
+	return articles, nil
+}
+
+// ArticleNumbers returns the numbers of the articles in group between
+// from and to, inclusive, in ascending order.
+func (b *groupStore) ArticleNumbers(group *Group, from, to int64) ([]int64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	index := b.indexes[group.Name]
+	if index == nil {
+		return nil, ErrNoSuchGroup
+	}
+
+	cutoff := b.retention.cutoff()
+	var numbers []int64
+	for _, e := range index.between(from, to) {
+		if e.live(cutoff) {
+			numbers = append(numbers, e.Num)
+		}
+	}
+
+	return numbers, nil
+}
+
+// loadArticle returns a stored article, numbering it within group when one
+// is given.
+// Callers must hold b.mu.
+func (b *groupStore) loadArticle(group *Group, id string) (*Article, error) {
+	art, err := b.storage.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if b.retention.expired(art.Arrived) {
+		return nil, ErrInvalidMessageID
+	}
+
+	article := &Article{
+		Header: art.Header,
+		Body:   bytes.NewReader(art.Body),
+		Bytes:  art.Bytes,
+		Lines:  art.Lines,
+
+		Arrived: art.Arrived,
+	}
+	if group != nil {
+		article.Number = art.Groups[group.Name]
+	}
+
+	return article, nil
+}
+
+// Post stores article and numbers it in its groups. Articles without a
+// Message-Id are rejected with ErrPostingFailed once their body is read.
+func (b *groupStore) Post(article *Article) error {
+	body, err := io.ReadAll(article.Body)
+	if err != nil {
+		return err
+	}
+	if article.MessageID() == "" {
+		return ErrPostingFailed
+	}
+
+	// Fill in the overview metadata when the poster didn't provide it
+	if article.Bytes == 0 {
+		article.Bytes = len(body)
+	}
+	if article.Lines == 0 {
+		article.Lines = bytes.Count(body, []byte("\n"))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	exists, err := b.storage.has(article.MessageID())
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrDuplicateArticle
+	}
+	if article.Arrived.IsZero() {
+		article.Arrived = b.retention.time()
+	}
+
+	// Number the article in every group it was posted to
+	names, xref := article.groups()
+	for _, name := range names {
+		b.ensureGroup(name)
+	}
+	groups, err := numberArticle(names, xref, b.indexes)
+	if err != nil {
+		return err
+	}
+
+	if err := b.storage.store(&backendArticle{
+		Id:     article.MessageID(),
+		Header: article.Header,
+		Body:   body,
+		Bytes:  article.Bytes,
+		Lines:  article.Lines,
+		Groups: groups,
+
+		Arrived: article.Arrived,
+	}); err != nil {
+		return err
+	}
+	for name, num := range groups {
+		index := b.indexes[name]
+		e := indexEntry{Num: num, Id: article.MessageID(), Arrived: article.Arrived.UnixNano()}
+		index.insert(e.Num, e.Id, e.Arrived)
+		if err := b.storage.saveIndex(name, index.Next, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HasArticle reports whether an article with the message-id is stored,
+// whether or not it is past retention.
+func (b *groupStore) HasArticle(id string) (bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.storage.has(id)
+}
+
+// Stat checks if an article exists and returns its number and id.
+// If group is nil, only message-id lookups are supported.
+func (b *groupStore) Stat(group *Group, id string) (string, string, error) {
+	article, err := b.GetArticle(group, id)
+	if err != nil {
+		return "", "", err
+	}
+
+	return strconv.FormatInt(article.Number, 10), article.MessageID(), nil
+}
+
+// SetClock replaces the clock used for arrival times and retention,
+// nil for time.Now.
+func (b *groupStore) SetClock(now func() time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.retention.now = now
+}
+
+// SetRetention hides articles that arrived more than period ago and
+// deletes them every interval (DefaultExpireInterval if 0). A period of 0
+// keeps articles forever.
+func (b *groupStore) SetRetention(period, interval time.Duration) {
+	b.mu.Lock()
+	b.retention.period = period
+	b.mu.Unlock()
+
+	if period <= 0 {
+		b.retention.stopJob()
+		return
+	}
+	b.retention.start(interval, func() {
+		if _, err := b.Expire(); err != nil {
+			log.Printf("Error expiring articles: %v", err)
+		}
+	})
+}
+
+// Expire deletes the articles past retention from the group indexes and
+// the storage and returns how many there were.
+func (b *groupStore) Expire() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cutoff := b.retention.cutoff()
+	if cutoff == 0 {
+		return 0, nil
+	}
+
+	expired := map[string]bool{}
+	for name, index := range b.indexes {
+		pruned := index.prune(cutoff)
+		if len(pruned) == 0 {
+			continue
+		}
+		if err := b.storage.removeEntries(name, pruned...); err != nil {
+			return 0, err
+		}
+		for _, e := range pruned {
+			expired[e.Id] = true
+		}
+	}
+	for id := range expired {
+		if err := b.storage.remove(id); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(expired), nil
+}
+
+// CreateGroup adds an empty group, failing if it exists.
+func (b *groupStore) CreateGroup(name, description string) (*Group, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.groups[name] != nil {
+		return nil, ErrGroupExists
+	}
+	group := b.ensureGroup(name)
+	if description != "" {
+		group.Description = description
+	}
+	b.updateGroup(group)
+	return group, b.storage.saveIndex(name, b.indexes[name].Next)
+}
+
+// DeleteGroup removes a group and the articles filed only under it.
+func (b *groupStore) DeleteGroup(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.groups[name] == nil {
+		return ErrNoSuchGroup
+	}
+	for _, e := range b.indexes[name].Entries {
+		art, err := b.storage.load(e.Id)
+		if err == ErrInvalidMessageID {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		delete(art.Groups, name)
+		if len(art.Groups) == 0 {
+			err = b.storage.remove(e.Id)
+		} else {
+			err = b.storage.store(art)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := b.storage.removeEntries(name, b.indexes[name].Entries...); err != nil {
+		return err
+	}
+	if err := b.storage.removeIndex(name); err != nil {
+		return err
+	}
+	delete(b.groups, name)
+	delete(b.indexes, name)
+	return nil
+}
+
+// DeleteArticle removes an article from the storage and its groups.
+func (b *groupStore) DeleteArticle(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	art, err := b.storage.load(id)
+	if err != nil {
+		return err
+	}
+	for name, num := range art.Groups {
+		if index := b.indexes[name]; index != nil {
+			index.remove(num)
+			if err := b.storage.removeEntries(name, indexEntry{Num: num, Id: id}); err != nil {
+				return err
+			}
+		}
+	}
+	return b.storage.remove(id)
+}
+
+// Reset drops all articles and groups, leaving an empty DefaultGroup.
+func (b *groupStore) Reset() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.storage.reset(); err != nil {
+		return err
+	}
+	b.groups = map[string]*Group{}
+	b.indexes = map[string]*articleIndex{}
+	b.ensureGroup(DefaultGroup)
+	return nil
+}
@@ -0,0 +1,167 @@
+package nntpserver
+
+import (
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer starts a server on a random local port, stopped when the
+// test ends. An empty Backend in config selects the memory backend.
+func startServer(t *testing.T, config Config) *Server {
+	t.Helper()
+
+	if config.Backend == "" {
+		config.Backend = MemoryBackendType
+	}
+	return start(t, config, NewServerWithConfig)
+}
+
+// forEachBackend runs test in a subtest for every storage type, with
+// config selecting it.
+func forEachBackend(t *testing.T, test func(t *testing.T, config Config)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, Config{Backend: MemoryBackendType})
+	})
+	t.Run("disk", func(t *testing.T) {
+		test(t, Config{
+			Backend:      DiskBackendType,
+			DBPath:       filepath.Join(t.TempDir(), "nntp.db"),
+			CleanOnClose: true,
+		})
+	})
+}
+
+// serveBackend is startServer for an existing backend.
+func serveBackend(t *testing.T, backend Backend, config Config) *Server {
+	t.Helper()
+
+	return start(t, config, func(config Config) (*Server, error) {
+		return NewServerWithBackend(backend, config)
+	})
+}
+
+func start(t *testing.T, config Config, newServer func(Config) (*Server, error)) *Server {
+	t.Helper()
+
+	config.Address = "127.0.0.1:0"
+	s, err := newServer(config)
+	if err != nil {
+		t.Fatalf("creating server: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// client is a test connection to a server.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	*textproto.Conn
+}
+
+// dial connects to s and reads the greeting.
+func dial(t *testing.T, s *Server) *client {
+	t.Helper()
+
+	nc, err := net.DialTimeout("tcp", s.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	nc.SetDeadline(time.Now().Add(10 * time.Second))
+	c := &client{t: t, conn: nc, Conn: textproto.NewConn(nc)}
+	t.Cleanup(func() { c.Close() })
+
+	c.expect("200")
+	return c
+}
+
+// line reads one response line.
+func (c *client) line() string {
+	c.t.Helper()
+	l, err := c.ReadLine()
+	if err != nil {
+		c.t.Fatalf("reading response: %v", err)
+	}
+	return l
+}
+
+// expect reads a response line and fails unless it starts with prefix.
+func (c *client) expect(prefix string) string {
+	c.t.Helper()
+	l := c.line()
+	if !strings.HasPrefix(l, prefix) {
+		c.t.Fatalf("got %q, want %q...", l, prefix)
+	}
+	return l
+}
+
+// cmd sends a command line and returns the status line of the response.
+func (c *client) cmd(format string, args ...any) string {
+	c.t.Helper()
+	if err := c.PrintfLine(format, args...); err != nil {
+		c.t.Fatalf("sending %q: %v", format, err)
+	}
+	return c.line()
+}
+
+// check sends a command and fails unless its status line starts with
+// prefix.
+func (c *client) check(prefix, format string, args ...any) string {
+	c.t.Helper()
+	l := c.cmd(format, args...)
+	if !strings.HasPrefix(l, prefix) {
+		c.t.Fatalf("%s: got %q, want %q...", format, l, prefix)
+	}
+	return l
+}
+
+// block reads the lines of a multi-line response.
+func (c *client) block() []string {
+	c.t.Helper()
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		c.t.Fatalf("reading multi-line response: %v", err)
+	}
+	return lines
+}
+
+// capabilities returns the capability lines announced to c.
+func (c *client) capabilities() []string {
+	c.t.Helper()
+	c.check("101", "CAPABILITIES")
+	return c.block()
+}
+
+// post sends an article with POST and fails unless it is accepted.
+func (c *client) post(header, body string) {
+	c.t.Helper()
+	c.check("340", "POST")
+	c.check("240", "%s\r\n\r\n%s\r\n.", strings.ReplaceAll(header, "\n", "\r\n"), body)
+}
+
+// postArticles stores articles with the given message-ids in group,
+// numbered 1 to len(ids).
+func postArticles(t *testing.T, b Backend, group string, ids ...string) {
+	t.Helper()
+	for i, id := range ids {
+		a := &Article{
+			Header: textproto.MIMEHeader{
+				"Message-Id": {id},
+				"Newsgroups": {group},
+				"Subject":    {"article " + strings.Trim(id, "<>")},
+				"From":       {"poster@example.com"},
+			},
+			Body: strings.NewReader("line one\nline two\n"),
+		}
+		if err := b.Post(a); err != nil {
+			t.Fatalf("posting article %d: %v", i+1, err)
+		}
+	}
+}
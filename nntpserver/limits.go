@@ -0,0 +1,95 @@
+package nntpserver
+
+// ConnectionLimits caps the number of simultaneous connections.
+// A limit of 0 means unlimited.
+type ConnectionLimits struct {
+	// Connections across all clients
+	Max int `yaml:"max"`
+	// Connections of each authenticated user
+	PerUser int `yaml:"per_user"`
+	// Per-user overrides of PerUser
+	Users map[string]int `yaml:"users"`
+	// Greeting sent to connections over Max: 400 (default) or 502
+	RejectCode int `yaml:"reject_code"`
+	// Reply to AUTHINFO PASS for users over their limit: 481 (default) or 502
+	UserRejectCode int `yaml:"user_reject_code"`
+}
+
+// ActiveConnections returns the number of connections being served.
+func (s *Server) ActiveConnections() int {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	return s.active
+}
+
+// UserConnections returns the number of connections authenticated as user.
+func (s *Server) UserConnections(user string) int {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	return s.userConns[user]
+}
+
+// acquireConn counts a new connection, reporting false when the server is full.
+func (s *Server) acquireConn() bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	if max := s.config.Connections.Max; max > 0 && s.active >= max {
+		return false
+	}
+	s.active++
+	return true
+}
+
+func (s *Server) releaseConn() {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	s.active--
+}
+
+// acquireUser counts a connection authenticated as user, reporting false
+// when the user already has all its connections open.
+func (s *Server) acquireUser(user string) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	max, ok := s.config.Connections.Users[user]
+	if !ok {
+		max = s.config.Connections.PerUser
+	}
+	if max > 0 && s.userConns[user] >= max {
+		return false
+	}
+
+	if s.userConns == nil {
+		s.userConns = map[string]int{}
+	}
+	s.userConns[user]++
+	return true
+}
+
+func (s *Server) releaseUser(user string) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	s.userConns[user]--
+	if s.userConns[user] <= 0 {
+		delete(s.userConns, user)
+	}
+}
+
+// rejectGreeting is sent instead of the welcome when the server is full.
+func (s *Server) rejectGreeting() *NNTPError {
+	if s.config.Connections.RejectCode == 502 {
+		return &NNTPError{502, "Service permanently unavailable"}
+	}
+	return &NNTPError{400, "Too many connections"}
+}
+
+// userRejection is the AUTHINFO reply for users over their limit.
+func (s *Server) userRejection() *NNTPError {
+	if s.config.Connections.UserRejectCode == 502 {
+		return &NNTPError{502, "Too many connections for this user"}
+	}
+	return &NNTPError{481, "Too many connections for this user"}
+}
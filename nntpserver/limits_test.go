@@ -0,0 +1,109 @@
+package nntpserver
+
+import (
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+// greeting connects to s and returns the first line it sends.
+func greeting(t *testing.T, s *Server) string {
+	t.Helper()
+
+	nc, err := net.DialTimeout("tcp", s.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer nc.Close()
+	nc.SetDeadline(time.Now().Add(10 * time.Second))
+
+	line, err := textproto.NewConn(nc).ReadLine()
+	if err != nil {
+		t.Fatalf("reading the greeting: %v", err)
+	}
+	return line
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestConnectionLimit(t *testing.T) {
+	for _, tc := range []struct {
+		code int
+		want string
+	}{
+		{0, "400 Too many connections"},
+		{502, "502 Service permanently unavailable"},
+	} {
+		s := startServer(t, Config{Connections: ConnectionLimits{Max: 2, RejectCode: tc.code}})
+
+		first := dial(t, s)
+		dial(t, s)
+		if got := greeting(t, s); got != tc.want {
+			t.Errorf("reject code %d: got %q, want %q", tc.code, got, tc.want)
+		}
+		if n := s.ActiveConnections(); n != 2 {
+			t.Errorf("%d active connections, want 2", n)
+		}
+
+		// A closed connection frees its slot
+		first.Close()
+		waitFor(t, "the connection to close", func() bool { return s.ActiveConnections() == 1 })
+		dial(t, s).check("211", "GROUP foo")
+	}
+}
+
+func TestUserConnectionLimit(t *testing.T) {
+	for _, tc := range []struct {
+		code int
+		want string
+	}{
+		{0, "481 Too many connections for this user"},
+		{502, "502 Too many connections for this user"},
+	} {
+		s := startServer(t, Config{
+			Auth: &AuthConfig{Users: map[string]string{"user": "pass", "pro": "pass"}},
+			Connections: ConnectionLimits{
+				PerUser:        1,
+				Users:          map[string]int{"pro": 2},
+				UserRejectCode: tc.code,
+			},
+		})
+
+		login := func(user string) *client {
+			c := dial(t, s)
+			c.check("381", "AUTHINFO USER %s", user)
+			return c
+		}
+
+		first := login("user")
+		first.check("281", "AUTHINFO PASS pass")
+		over := login("user")
+		if got := over.cmd("AUTHINFO PASS pass"); got != tc.want {
+			t.Errorf("reject code %d: got %q, want %q", tc.code, got, tc.want)
+		}
+		if _, err := over.ReadLine(); err == nil {
+			t.Error("connection over the user limit left open")
+		}
+
+		// Overrides apply per user
+		login("pro").check("281", "AUTHINFO PASS pass")
+		login("pro").check("281", "AUTHINFO PASS pass")
+		login("pro").check(tc.want[:3], "AUTHINFO PASS pass")
+		if n := s.UserConnections("pro"); n != 2 {
+			t.Errorf("pro has %d connections, want 2", n)
+		}
+
+		first.Close()
+		waitFor(t, "the user's connection to close", func() bool { return s.UserConnections("user") == 0 })
+		login("user").check("281", "AUTHINFO PASS pass")
+	}
+}
@@ -0,0 +1,91 @@
+package nntpserver
+
+import (
+	"maps"
+	"net/textproto"
+)
+
+// MemoryBackend keeps everything in memory. It needs no filesystem access,
+// which makes it the fastest choice for unit tests.
+type MemoryBackend struct {
+	*groupStore
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{newGroupStore(memoryStorage{}, nil)}
+}
+
+func (b *MemoryBackend) Authorized() bool {
+	return true
+}
+
+// Authenticate accepts any credentials, a user database is added by
+// configuring Config.Auth.
+func (b *MemoryBackend) Authenticate(user, pass string) (Backend, error) {
+	return nil, nil
+}
+
+func (b *MemoryBackend) AllowPost() bool {
+	return true
+}
+
+// Close drops all articles.
+func (b *MemoryBackend) Close() error {
+	b.retention.stopJob()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.storage.reset()
+}
+
+// memoryStorage maps message-ids to articles.
+type memoryStorage map[string]*backendArticle
+
+// load returns a copy of the stored article, so callers can't change it.
+func (m memoryStorage) load(id string) (*backendArticle, error) {
+	art := m[id]
+	if art == nil {
+		return nil, ErrInvalidMessageID
+	}
+
+	header := make(textproto.MIMEHeader, len(art.Header))
+	for k, v := range art.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	cp := *art
+	cp.Header = header
+	cp.Groups = maps.Clone(art.Groups)
+	return &cp, nil
+}
+
+func (m memoryStorage) store(art *backendArticle) error {
+	m[art.Id] = art
+	return nil
+}
+
+func (m memoryStorage) remove(id string) error {
+	delete(m, id)
+	return nil
+}
+
+func (m memoryStorage) has(id string) (bool, error) {
+	return m[id] != nil, nil
+}
+
+func (m memoryStorage) reset() error {
+	clear(m)
+	return nil
+}
+
+// The indexes of the memory backend live only in its groupStore.
+func (m memoryStorage) saveIndex(group string, next int64, entries ...indexEntry) error {
+	return nil
+}
+
+func (m memoryStorage) removeEntries(group string, entries ...indexEntry) error {
+	return nil
+}
+
+func (m memoryStorage) removeIndex(group string) error {
+	return nil
+}
@@ -0,0 +1,185 @@
+package nntpserver
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the Prometheus collectors of a server. Every server has
+// its own registry so several can run in one process.
+type metrics struct {
+	registry        *prometheus.Registry
+	commands        *prometheus.CounterVec
+	commandDuration *prometheus.HistogramVec
+	bytesReceived   prometheus.Counter
+	bytesSent       prometheus.Counter
+	authFailures    prometheus.Counter
+	backendDuration *prometheus.HistogramVec
+}
+
+func newMetrics(s *Server) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nntp_commands_total",
+			Help: "Commands processed, by verb and response code.",
+		}, []string{"command", "code"}),
+		commandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nntp_command_duration_seconds",
+			Help:    "Time taken to process commands, by verb.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"command"}),
+		bytesReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nntp_received_bytes_total",
+			Help: "Bytes read from client connections.",
+		}),
+		bytesSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nntp_sent_bytes_total",
+			Help: "Bytes written to client connections.",
+		}),
+		authFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nntp_auth_failures_total",
+			Help: "Authentication attempts rejected for bad credentials.",
+		}),
+		backendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nntp_backend_duration_seconds",
+			Help:    "Latency of backend calls, by operation.",
+			Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"op"}),
+	}
+
+	m.registry.MustRegister(
+		m.commands,
+		m.commandDuration,
+		m.bytesReceived,
+		m.bytesSent,
+		m.authFailures,
+		m.backendDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "nntp_active_sessions",
+			Help: "Client sessions currently open.",
+		}, func() float64 {
+			s.connsMu.Lock()
+			defer s.connsMu.Unlock()
+			return float64(len(s.sessions))
+		}),
+	)
+	return m
+}
+
+// observeCommand records a processed command. code is its response code,
+// 0 when none was sent.
+func (m *metrics) observeCommand(verb string, code int, took time.Duration) {
+	label := "none"
+	if code > 0 {
+		label = strconv.Itoa(code)
+	}
+	m.commands.WithLabelValues(verb, label).Inc()
+	m.commandDuration.WithLabelValues(verb).Observe(took.Seconds())
+}
+
+// MetricsHandler returns the server metrics in the Prometheus text format.
+func (s *Server) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
+}
+
+// MetricsAddr returns the address metrics are served on, nil if they
+// aren't.
+func (s *Server) MetricsAddr() net.Addr {
+	if s.metricsListener == nil {
+		return nil
+	}
+	return s.metricsListener.Addr()
+}
+
+// commandLabel returns the verb cmd is counted under, keeping unknown
+// commands from growing the label set.
+func (s *Server) commandLabel(cmd string) string {
+	verb := strings.ToLower(cmd)
+	if _, ok := s.Handlers[verb]; !ok || verb == "" {
+		return "unknown"
+	}
+	return verb
+}
+
+// meteredConn counts the bytes of a client connection.
+type meteredConn struct {
+	net.Conn
+	metrics *metrics
+}
+
+func (mc *meteredConn) Read(p []byte) (int, error) {
+	n, err := mc.Conn.Read(p)
+	mc.metrics.bytesReceived.Add(float64(n))
+	return n, err
+}
+
+func (mc *meteredConn) Write(p []byte) (int, error) {
+	n, err := mc.Conn.Write(p)
+	mc.metrics.bytesSent.Add(float64(n))
+	return n, err
+}
+
+// statusRecorder notes the code of the status line of a response in its
+// session.
+type statusRecorder struct {
+	io.ReadWriteCloser
+	sess *session
+}
+
+func (sr *statusRecorder) Write(p []byte) (int, error) {
+	if sr.sess.awaitingStatus && len(p) >= 3 {
+		sr.sess.awaitingStatus = false
+		if code, err := strconv.Atoi(string(p[:3])); err == nil {
+			sr.sess.status = code
+		}
+	}
+	return sr.ReadWriteCloser.Write(p)
+}
+
+// meteredBackend times the backend calls that serve and store articles.
+type meteredBackend struct {
+	Backend
+	metrics *metrics
+}
+
+func (mb *meteredBackend) observe(op string, since time.Time) {
+	mb.metrics.backendDuration.WithLabelValues(op).Observe(time.Since(since).Seconds())
+}
+
+func (mb *meteredBackend) GetArticle(group *Group, id string) (*Article, error) {
+	defer mb.observe("get_article", time.Now())
+	return mb.Backend.GetArticle(group, id)
+}
+
+func (mb *meteredBackend) GetArticles(group *Group, from, to int64) ([]NumberedArticle, error) {
+	defer mb.observe("get_articles", time.Now())
+	return mb.Backend.GetArticles(group, from, to)
+}
+
+func (mb *meteredBackend) ArticleNumbers(group *Group, from, to int64) ([]int64, error) {
+	return articleNumbers(mb.Backend, group, from, to)
+}
+
+func (mb *meteredBackend) HasArticle(id string) (bool, error) {
+	return hasArticle(mb.Backend, id)
+}
+
+func (mb *meteredBackend) Post(article *Article) error {
+	defer mb.observe("post", time.Now())
+	return mb.Backend.Post(article)
+}
+
+func (mb *meteredBackend) Close() error {
+	if closer, ok := mb.Backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
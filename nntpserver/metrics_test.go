@@ -0,0 +1,54 @@
+package nntpserver
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// metricValue returns the sample of the unlabelled metric name served by s.
+func metricValue(t *testing.T, s *Server, name string) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), name+" "); ok {
+			return value
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return ""
+}
+
+func TestAuthFailuresMetric(t *testing.T) {
+	s := startServer(t, Config{
+		Auth:        &AuthConfig{Users: map[string]string{"user": "pass"}},
+		Connections: ConnectionLimits{PerUser: 1},
+	})
+
+	c := dial(t, s)
+	c.check("381", "AUTHINFO USER user")
+	c.check("481", "AUTHINFO PASS wrong")
+	c.check("481", "AUTHINFO SASL PLAIN AHVzZXIAd3Jvbmc=") // user, wrong
+	c.check("481", "AUTHINFO SASL PLAIN AAB3cm9uZw==")     // no user
+	if got := metricValue(t, s, "nntp_auth_failures_total"); got != "3" {
+		t.Fatalf("after bad credentials: nntp_auth_failures_total = %s, want 3", got)
+	}
+
+	// Neither a cancelled exchange nor the per-user limit is a failure
+	c.check("383", "AUTHINFO SASL PLAIN")
+	c.check("481", "*")
+	c.check("381", "AUTHINFO USER user")
+	c.check("281", "AUTHINFO PASS pass")
+
+	other := dial(t, s)
+	other.check("381", "AUTHINFO USER user")
+	other.check("481", "AUTHINFO PASS pass")
+	if got := metricValue(t, s, "nntp_auth_failures_total"); got != "3" {
+		t.Fatalf("nntp_auth_failures_total = %s, want 3", got)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io"
 	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // PostingStatus type for groups.
@@ -35,8 +38,64 @@ type Article struct {
 	Body   io.Reader
 	Bytes  int
 	Lines  int
+	// Number of the article in the group it was retrieved from,
+	// 0 if it was looked up without a group or isn't in it.
+	Number int64
+	// When the server received the article, zero if unknown. Backends
+	// fill it in on Post when it is zero.
+	Arrived time.Time
 }
 
 func (a *Article) MessageID() string {
 	return a.Header.Get("Message-Id")
 }
+
+// Newsgroups returns the groups listed in the Newsgroups header.
+// Articles without one are filed under DefaultGroup.
+func (a *Article) Newsgroups() []string {
+	var groups []string
+	for _, name := range strings.Split(a.Header.Get("Newsgroups"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	if len(groups) == 0 {
+		groups = []string{DefaultGroup}
+	}
+	return groups
+}
+
+// groups returns the groups an article is filed under and the numbers its
+// Xref header asks for. Groups named only in Xref are included, and
+// DefaultGroup is only used when neither header names one.
+func (a *Article) groups() ([]string, map[string]int64) {
+	xref := map[string]int64{}
+	var names []string
+	seen := map[string]bool{}
+
+	// Xref: server group:number [group:number ...]
+	fields := strings.Fields(a.Header.Get("Xref"))
+	for _, f := range fields[min(1, len(fields)):] {
+		name, num, ok := strings.Cut(f, ":")
+		n, err := strconv.ParseInt(num, 10, 64)
+		if !ok || err != nil || n < 1 {
+			continue
+		}
+		xref[name] = n
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	if a.Header.Get("Newsgroups") == "" && len(names) > 0 {
+		return names, xref
+	}
+	for _, name := range a.Newsgroups() {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, xref
+}
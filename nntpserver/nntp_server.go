@@ -2,11 +2,15 @@
 package nntpserver
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"log"
 	"math"
 	"net"
+	"net/http"
 	"net/textproto"
 	"strconv"
 	"strings"
@@ -14,22 +18,79 @@ import (
 	"time"
 )
 
+// BackendType selects the storage created by NewServerWithConfig.
+type BackendType string
+
+// BackendType values.
+const (
+	DiskBackendType   = BackendType("disk")
+	MemoryBackendType = BackendType("memory")
+)
+
 // Config holds the server configuration options.
 type Config struct {
 	// Address to listen on (e.g., ":1199" or ":0" for random port)
-	Address string
+	Address string `yaml:"address"`
+	// Address of the admin HTTP API (empty disables it), see AdminHandler
+	AdminAddress string `yaml:"admin_address"`
+	// Address serving Prometheus metrics on /metrics (empty disables it),
+	// see MetricsHandler
+	MetricsAddress string `yaml:"metrics_address"`
+	// Storage to use (empty for DiskBackendType)
+	Backend BackendType `yaml:"backend"`
 	// Path to database file (empty for default "nntp.db")
-	DBPath string
+	DBPath string `yaml:"db_path"`
 	// Delete database on close (useful for tests)
-	CleanOnClose bool
+	CleanOnClose bool `yaml:"clean_on_close"`
+	// TLS settings (nil disables both implicit TLS and STARTTLS)
+	TLS *TLSConfig `yaml:"tls"`
+	// Hide articles that arrived longer ago than this and delete them in
+	// the background (0 keeps articles forever)
+	Retention time.Duration `yaml:"retention"`
+	// How often expired articles are deleted (0 for DefaultExpireInterval)
+	ExpireInterval time.Duration `yaml:"expire_interval"`
+	// Clock for arrival times and retention (nil for time.Now)
+	Clock func() time.Time `yaml:"-"`
+	// Fixture files or directories posted at startup, see LoadFixtures
+	Fixtures []string `yaml:"fixtures"`
+	// NZBs whose segments are generated from their source files at startup
+	NZBs []NZBSource `yaml:"nzbs"`
+	// Accepted credentials (nil accepts any AUTHINFO credentials)
+	Auth *AuthConfig `yaml:"auth"`
+	// Faults injected into matching commands, see Server.SetFaultRules
+	Faults []FaultRule `yaml:"faults"`
+	// Damage done to yEnc bodies served by BODY, see Server.SetCorruptionRules
+	Corruptions []CorruptionRule `yaml:"corruptions"`
+	// Seed for the fault and corruption dice (0 picks a random seed)
+	FaultSeed int64 `yaml:"fault_seed"`
+	// Write rate limits
+	Bandwidth BandwidthConfig `yaml:"bandwidth"`
+	// Simultaneous connection limits
+	Connections ConnectionLimits `yaml:"connections"`
+	// Refuse COMPRESS on TLS sessions, guarding against CRIME style attacks
+	NoCompressWithTLS bool `yaml:"no_compress_with_tls"`
+	// Close connections that send no command for this long (0 disables)
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// Deadline for reading the data of a command, like a POST body (0 disables)
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// Deadline for writing each response (0 disables)
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// How long Close waits for sessions before interrupting them (0
+	// interrupts them at once)
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
 }
 
+// DefaultShutdownTimeout is how long the sessions of a server built from
+// DefaultConfig get to finish when it is closed.
+const DefaultShutdownTimeout = 5 * time.Second
+
 // DefaultConfig returns a Config with sensible defaults.
 func DefaultConfig() Config {
 	return Config{
-		Address:      ":1199",
-		DBPath:       "",
-		CleanOnClose: false,
+		Address:         ":1199",
+		DBPath:          "",
+		CleanOnClose:    false,
+		ShutdownTimeout: DefaultShutdownTimeout,
 	}
 }
 
@@ -42,14 +103,18 @@ var ErrNoSuchGroup = &NNTPError{411, "No such newsgroup"}
 var ErrNoGroupSelected = &NNTPError{412, "No newsgroup selected"}
 var ErrInvalidMessageID = &NNTPError{430, "No article with that message-id"}
 var ErrInvalidArticleNumber = &NNTPError{423, "No article with that number"}
+var ErrNoArticlesInRange = &NNTPError{423, "No articles in that range"}
 var ErrNoCurrentArticle = &NNTPError{420, "Current article number is invalid"}
+var ErrNoNextArticle = &NNTPError{421, "No next article in this group"}
+var ErrNoPrevArticle = &NNTPError{422, "No previous article in this group"}
 var ErrUnknownCommand = &NNTPError{500, "Unknown command"}
 var ErrSyntax = &NNTPError{501, "not supported, or syntax error"}
 var ErrPostingNotPermitted = &NNTPError{440, "Posting not permitted"}
 var ErrPostingFailed = &NNTPError{441, "posting failed"}
 var ErrNotWanted = &NNTPError{435, "Article not wanted"}
+var ErrDuplicateArticle = &NNTPError{441, "Duplicate article"}
 var ErrAuthRequired = &NNTPError{450, "authorization required"}
-var ErrAuthRejected = &NNTPError{452, "authorization rejected"}
+var ErrAuthRejected = &NNTPError{481, "Authentication failed/rejected"}
 var ErrNotAuthenticated = &NNTPError{480, "authentication required"}
 
 type Handler func(args []string, s *session, c *textproto.Conn) error
@@ -71,10 +136,80 @@ type Backend interface {
 	Stat(group *Group, id string) (string, string, error)
 }
 
+// articleNumberer is implemented by the backends that can list article
+// numbers without loading the articles.
+type articleNumberer interface {
+	ArticleNumbers(group *Group, from, to int64) ([]int64, error)
+}
+
+// articleChecker is implemented by the backends that can tell whether an
+// article is stored without loading it.
+type articleChecker interface {
+	HasArticle(id string) (bool, error)
+}
+
+// hasArticle reports whether an article with the message-id is stored.
+// Backends that don't implement articleChecker are asked for the article.
+func hasArticle(backend Backend, id string) (bool, error) {
+	if c, ok := backend.(articleChecker); ok {
+		return c.HasArticle(id)
+	}
+
+	_, err := backend.GetArticle(nil, id)
+	switch err {
+	case nil:
+		return true, nil
+	case ErrInvalidMessageID:
+		return false, nil
+	}
+	return false, err
+}
+
+// articleNumbers returns the numbers of the articles in group between from
+// and to, inclusive, in ascending order. Backends that don't implement
+// articleNumberer are asked for the articles themselves.
+func articleNumbers(backend Backend, group *Group, from, to int64) ([]int64, error) {
+	if n, ok := backend.(articleNumberer); ok {
+		return n.ArticleNumbers(group, from, to)
+	}
+
+	articles, err := backend.GetArticles(group, from, to)
+	if err != nil {
+		return nil, err
+	}
+	numbers := make([]int64, len(articles))
+	for i, na := range articles {
+		numbers[i] = na.Num
+	}
+	return numbers, nil
+}
+
 type session struct {
+	id      uint64    // shown by the admin API
+	started time.Time // when the connection was accepted
 	server  *Server
 	backend Backend
 	group   *Group
+	article int64 // current article number, 0 when invalid
+
+	raw      net.Conn // accepted connection, closing it interrupts the session
+	conn     net.Conn
+	text     *textproto.Conn
+	faults   *faultConn
+	throttle *throttle
+	tls      bool
+	// COMPRESS DEFLATE is active
+	compressed bool
+	// XFEATURE COMPRESS GZIP is active, with the optional plain terminator
+	gzipOverview   bool
+	gzipTerminator bool
+
+	// Code of the response to the current command, 0 until one is sent
+	status         int
+	awaitingStatus bool
+
+	pendingUser string // user name sent by AUTHINFO USER
+	user        string // authenticated user name, set under Server.connsMu
 }
 
 type Server struct {
@@ -87,16 +222,46 @@ type Server struct {
 	config   Config
 	done     chan struct{}
 	wg       sync.WaitGroup
+
+	admin         *http.Server
+	adminListener net.Listener
+
+	metrics         *metrics
+	metricsServer   *http.Server
+	metricsListener net.Listener
+
+	tlsConfig *tls.Config
+	rootCAs   *x509.CertPool
+	faults    *faultInjector
+	corruptor *corruptor
+
+	globalBucket *tokenBucket
+	bucketsMu    sync.Mutex
+	userBuckets  map[string]*tokenBucket
+
+	connsMu   sync.Mutex
+	active    int
+	userConns map[string]int
+	sessions  map[*session]struct{}
+	closing   bool                // sessions are being interrupted, accept no more
+	lastID    uint64              // id of the newest session
+	offers    map[string]*session // message-ids a session got 238 for
+	stopOnce  sync.Once
 }
 
 func NewServer(backend Backend) *Server {
 	rv := Server{
 		Handlers: make(map[string]Handler),
 		Backend:  backend,
+		faults:   newFaultInjector(nil, 0),
+
+		corruptor: newCorruptor(nil, 0),
 	}
+	rv.metrics = newMetrics(&rv)
 	rv.Handlers[""] = handleDefault
 	rv.Handlers["quit"] = handleQuit
 	rv.Handlers["group"] = handleGroup
+	rv.Handlers["listgroup"] = handleListGroup
 	rv.Handlers["list"] = handleList
 	rv.Handlers["head"] = handleHead
 	rv.Handlers["body"] = handleBody
@@ -108,8 +273,18 @@ func NewServer(backend Backend) *Server {
 	rv.Handlers["authinfo"] = handleAuthInfo
 	rv.Handlers["newgroups"] = handleNewGroups
 	rv.Handlers["over"] = handleOver
-	rv.Handlers["xover"] = handleOver
+	rv.Handlers["xover"] = handleXOver
+	rv.Handlers["xzver"] = handleXZVer
+	rv.Handlers["xfeature"] = handleXFeature
+	rv.Handlers["hdr"] = handleHdr
+	rv.Handlers["xhdr"] = handleXHdr
 	rv.Handlers["stat"] = handleStat
+	rv.Handlers["starttls"] = handleStartTLS
+	rv.Handlers["next"] = handleNext
+	rv.Handlers["last"] = handleLast
+	rv.Handlers["check"] = handleCheck
+	rv.Handlers["takethis"] = handleTakeThis
+	rv.Handlers["compress"] = handleCompress
 
 	return &rv
 }
@@ -120,9 +295,8 @@ func NewServer(backend Backend) *Server {
 // Example:
 //
 //	config := nntpserver.Config{
-//	    Address:      ":0",  // Random available port
-//	    DBPath:       filepath.Join(t.TempDir(), "test.db"),
-//	    CleanOnClose: true,
+//	    Address: ":0",  // Random available port
+//	    Backend: nntpserver.MemoryBackendType,
 //	}
 //	server, err := nntpserver.NewServerWithConfig(config)
 //	if err != nil {
@@ -132,17 +306,93 @@ func NewServer(backend Backend) *Server {
 //	server.Start()
 //	addr := server.Addr().String()
 func NewServerWithConfig(config Config) (*Server, error) {
-	backend := NewDiskBackend(config.CleanOnClose, config.DBPath)
+	backend, err := newBackend(config)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, err := NewServerWithBackend(backend, config)
+	if err != nil {
+		backend.(io.Closer).Close()
+		return nil, err
+	}
+	return rv, nil
+}
+
+// newBackend creates the storage described by config and seeds it.
+func newBackend(config Config) (Backend, error) {
+	var backend Backend
+	switch config.Backend {
+	case "", DiskBackendType:
+		backend = NewDiskBackend(config.CleanOnClose, config.DBPath)
+	case MemoryBackendType:
+		backend = NewMemoryBackend()
+	default:
+		return nil, fmt.Errorf("unknown backend %q", config.Backend)
+	}
+	if r, ok := backend.(retainer); ok {
+		r.SetClock(config.Clock)
+		r.SetRetention(config.Retention, config.ExpireInterval)
+	}
+
+	for _, path := range config.Fixtures {
+		if _, err := LoadFixtures(backend, path); err != nil {
+			backend.(io.Closer).Close()
+			return nil, err
+		}
+	}
+
+	for _, source := range config.NZBs {
+		if _, err := ImportNZBFile(backend, source); err != nil {
+			backend.(io.Closer).Close()
+			return nil, err
+		}
+	}
+
+	return backend, nil
+}
+
+// NewServerWithBackend creates a server for an existing backend, ignoring
+// the storage fields of config. The backend is closed when the server
+// stops, but not when an error is returned.
+func NewServerWithBackend(backend Backend, config Config) (*Server, error) {
+	if err := validateFaultRules(config.Faults); err != nil {
+		return nil, err
+	}
+	for _, rule := range config.Corruptions {
+		if !rule.Mode.valid() {
+			return nil, fmt.Errorf("unknown yEnc corruption %q", rule.Mode)
+		}
+	}
+
+	metered := &meteredBackend{Backend: backend}
+	backend = metered
+
+	if config.Auth != nil {
+		authBackend, err := newAuthBackend(backend, config.Auth)
+		if err != nil {
+			return nil, err
+		}
+		backend = authBackend
+	}
 
 	rv := &Server{
 		Handlers: make(map[string]Handler),
 		Backend:  backend,
 		config:   config,
 		done:     make(chan struct{}),
+		faults:   newFaultInjector(config.Faults, config.FaultSeed),
+
+		corruptor: newCorruptor(config.Corruptions, config.FaultSeed),
+
+		globalBucket: newTokenBucket(config.Bandwidth.Global, config.Bandwidth.Burst),
 	}
+	rv.metrics = newMetrics(rv)
+	metered.metrics = rv.metrics
 	rv.Handlers[""] = handleDefault
 	rv.Handlers["quit"] = handleQuit
 	rv.Handlers["group"] = handleGroup
+	rv.Handlers["listgroup"] = handleListGroup
 	rv.Handlers["list"] = handleList
 	rv.Handlers["head"] = handleHead
 	rv.Handlers["body"] = handleBody
@@ -154,15 +404,34 @@ func NewServerWithConfig(config Config) (*Server, error) {
 	rv.Handlers["authinfo"] = handleAuthInfo
 	rv.Handlers["newgroups"] = handleNewGroups
 	rv.Handlers["over"] = handleOver
-	rv.Handlers["xover"] = handleOver
+	rv.Handlers["xover"] = handleXOver
+	rv.Handlers["xzver"] = handleXZVer
+	rv.Handlers["xfeature"] = handleXFeature
+	rv.Handlers["hdr"] = handleHdr
+	rv.Handlers["xhdr"] = handleXHdr
 	rv.Handlers["stat"] = handleStat
+	rv.Handlers["starttls"] = handleStartTLS
+	rv.Handlers["next"] = handleNext
+	rv.Handlers["last"] = handleLast
+	rv.Handlers["check"] = handleCheck
+	rv.Handlers["takethis"] = handleTakeThis
+	rv.Handlers["compress"] = handleCompress
+
+	if config.TLS != nil {
+		tlsConfig, rootCAs, err := newTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		rv.tlsConfig = tlsConfig
+		rv.rootCAs = rootCAs
+	}
 
 	return rv, nil
 }
 
 // Start begins accepting connections on the configured address.
 // This method is non-blocking; it spawns a goroutine to handle connections.
-// Use Stop() or Close() to shut down the server.
+// Use Stop or Close to shut down the server.
 func (s *Server) Start() error {
 	addr, err := net.ResolveTCPAddr("tcp", s.config.Address)
 	if err != nil {
@@ -175,6 +444,30 @@ func (s *Server) Start() error {
 	}
 	s.listener = listener
 
+	if s.config.TLS != nil && s.config.TLS.Implicit {
+		s.listener = tls.NewListener(listener, s.tlsConfig)
+	}
+
+	if s.config.AdminAddress != "" {
+		s.admin, s.adminListener, err = s.serveHTTP(s.config.AdminAddress, s.AdminHandler())
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("admin API: %w", err)
+		}
+	}
+	if s.config.MetricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", s.MetricsHandler())
+		s.metricsServer, s.metricsListener, err = s.serveHTTP(s.config.MetricsAddress, mux)
+		if err != nil {
+			listener.Close()
+			if s.admin != nil {
+				s.admin.Close()
+			}
+			return fmt.Errorf("metrics: %w", err)
+		}
+	}
+
 	s.wg.Add(1)
 	go s.acceptLoop()
 
@@ -206,25 +499,94 @@ func (s *Server) acceptLoop() {
 
 // Stop gracefully shuts down the server.
 // It closes the listener, waits for active connections to finish,
-// and closes the backend.
-func (s *Server) Stop() error {
-	close(s.done)
+// and closes the backend. Connections still open when ctx is done are
+// closed, and Stop then returns the context error.
+func (s *Server) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.done) })
 
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	if s.admin != nil {
+		s.admin.Close()
+	}
+	if s.metricsServer != nil {
+		s.metricsServer.Close()
+	}
 
-	s.wg.Wait()
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	var err error
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		err = ctx.Err()
+		// Connections accepted from now on are closed as they register
+		s.closeSessions()
+		<-finished
+	}
 
 	if closer, ok := s.Backend.(interface{ Close() error }); ok {
-		return closer.Close()
+		if cerr := closer.Close(); cerr != nil {
+			return cerr
+		}
 	}
-	return nil
+	return err
 }
 
-// Close is an alias for Stop, implementing io.Closer.
+// Close stops the server, implementing io.Closer. Sessions are interrupted
+// after Config.ShutdownTimeout, at once if it is 0.
 func (s *Server) Close() error {
-	return s.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+	err := s.Stop(ctx)
+	if s.config.ShutdownTimeout <= 0 && err == context.DeadlineExceeded {
+		// Not waiting was asked for
+		return nil
+	}
+	return err
+}
+
+// addSession registers sess, failing once the server interrupts sessions.
+func (s *Server) addSession(sess *session) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.closing {
+		return false
+	}
+	if s.sessions == nil {
+		s.sessions = map[*session]struct{}{}
+	}
+	s.lastID++
+	sess.id = s.lastID
+	s.sessions[sess] = struct{}{}
+	return true
+}
+
+func (s *Server) removeSession(sess *session) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.sessions, sess)
+	for id, owner := range s.offers {
+		if owner == sess {
+			delete(s.offers, id)
+		}
+	}
+}
+
+// closeSessions interrupts every active session and those registering
+// later.
+func (s *Server) closeSessions() {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	s.closing = true
+	for sess := range s.sessions {
+		sess.raw.Close()
+	}
 }
 
 // Addr returns the listener's network address.
@@ -250,25 +612,80 @@ func (s *session) dispatchCommand(cmd string, args []string,
 		if !found {
 			panic("No default handler.")
 		}
+	} else if !s.backend.Authorized() && !authExempt[strings.ToLower(cmd)] {
+		skipArticle(cmd, c)
+		return ErrNotAuthenticated
+	}
+
+	action := s.server.faults.roll(cmd)
+	if action.delay > 0 {
+		time.Sleep(action.delay)
+	}
+	if action.err != nil {
+		skipArticle(cmd, c)
+		return action.err
 	}
-	return handler(args, s, c)
+
+	s.faults.arm(action)
+	err = handler(args, s, c)
+	if ferr := s.faults.finish(); ferr != nil {
+		return ferr
+	}
+	return err
+}
+
+// authExempt lists the commands allowed before authentication.
+var authExempt = map[string]bool{
+	"authinfo":     true,
+	"capabilities": true,
+	"compress":     true,
+	"mode":         true,
+	"quit":         true,
+	"starttls":     true,
 }
 
 // Process an NNTP session.
 func (s *Server) Process(nc net.Conn) {
-	defer nc.Close()
-	c := textproto.NewConn(nc)
-
 	sess := &session{
-		server:  s,
-		backend: s.Backend,
-		group:   nil,
+		started:  time.Now(),
+		server:   s,
+		backend:  s.Backend,
+		group:    nil,
+		raw:      nc,
+		throttle: s.newThrottle(),
 	}
+	_, sess.tls = nc.(*tls.Conn)
+	metered := &meteredConn{Conn: nc, metrics: s.metrics}
+	sess.setConn(&throttledConn{Conn: metered, throttle: sess.throttle})
+	defer func() { sess.conn.Close() }()
+
+	if !s.acquireConn() {
+		sess.text.PrintfLine(s.rejectGreeting().Error())
+		return
+	}
+	defer s.releaseConn()
+	defer func() {
+		if sess.user != "" {
+			s.releaseUser(sess.user)
+		}
+	}()
+	if !s.addSession(sess) {
+		return
+	}
+	defer s.removeSession(sess)
 
-	c.PrintfLine("200 Hello!")
+	sess.text.PrintfLine("200 Hello!")
 	for {
+		// Commands like STARTTLS replace the connection mid-session
+		c := sess.text
+		sess.conn.SetReadDeadline(deadline(s.config.IdleTimeout))
 		l, err := c.ReadLine()
 		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				sess.conn.SetWriteDeadline(deadline(s.config.WriteTimeout))
+				c.PrintfLine("400 Idle timeout, closing connection")
+				return
+			}
 			log.Printf("Error reading from client, dropping conn: %v", err)
 			return
 		}
@@ -279,8 +696,17 @@ func (s *Server) Process(nc net.Conn) {
 			args = cmd[1:]
 		}
 		since := time.Now()
+		sess.conn.SetReadDeadline(deadline(s.config.ReadTimeout))
+		sess.conn.SetWriteDeadline(deadline(s.config.WriteTimeout))
+		sess.status, sess.awaitingStatus = 0, true
 		err = sess.dispatchCommand(cmd[0], args, c)
-		log.Printf("Command  %+v took %v", cmd, time.Since(since))
+		took := time.Since(since)
+		log.Printf("Command  %+v took %v", cmd, took)
+		status := sess.status
+		if nerr, ok := err.(*NNTPError); ok {
+			status = nerr.Code
+		}
+		s.metrics.observeCommand(s.commandLabel(cmd[0]), status, took)
 		if err != nil {
 			_, isNNTPError := err.(*NNTPError)
 			switch {
@@ -288,7 +714,7 @@ func (s *Server) Process(nc net.Conn) {
 				// Drop this connection silently. They hung up
 				return
 			case isNNTPError:
-				c.PrintfLine(err.Error())
+				sess.text.PrintfLine(err.Error())
 			default:
 				log.Printf("Error dispatching command, dropping conn: %v",
 					err)
@@ -298,24 +724,41 @@ func (s *Server) Process(nc net.Conn) {
 	}
 }
 
-func parseRange(spec string) (low, high int64) {
+// deadline returns the time d from now, or no deadline when d is 0.
+func deadline(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
+// setConn switches the session to nc for all further reads and writes.
+func (s *session) setConn(nc net.Conn) {
+	s.conn = nc
+	s.faults = &faultConn{Conn: nc}
+	s.text = textproto.NewConn(&statusRecorder{ReadWriteCloser: s.faults, sess: s})
+}
+
+// parseRange parses the range argument of OVER, HDR and LISTGROUP: a
+// number, "n-" or "n-m". An empty spec covers every article.
+func parseRange(spec string) (low, high int64, err error) {
 	if spec == "" {
-		return 0, math.MaxInt64
+		return 0, math.MaxInt64, nil
 	}
-	parts := strings.Split(spec, "-")
-	if len(parts) == 1 {
-		h, err := strconv.ParseInt(parts[0], 10, 64)
-		if err != nil {
-			h = math.MaxInt64
-		}
-		return 0, h
+	from, to, isRange := strings.Cut(spec, "-")
+	if low, err = strconv.ParseInt(from, 10, 64); err != nil {
+		return 0, 0, ErrSyntax
 	}
-	l, _ := strconv.ParseInt(parts[0], 10, 64)
-	h, err := strconv.ParseInt(parts[1], 10, 64)
-	if err != nil {
-		h = math.MaxInt64
+	switch {
+	case !isRange:
+		return low, low, nil
+	case to == "":
+		return low, math.MaxInt64, nil
+	}
+	if high, err = strconv.ParseInt(to, 10, 64); err != nil {
+		return 0, 0, ErrSyntax
 	}
-	return l, h
+	return low, high, nil
 }
 
 /*
@@ -330,29 +773,166 @@ func parseRange(spec string) (low, high int64) {
 */
 
 func handleOver(args []string, s *session, c *textproto.Conn) error {
-	if s.group == nil {
-		return ErrNoGroupSelected
-	}
-	from, to := parseRange(args[0])
-	articles, err := s.backend.GetArticles(s.group, from, to)
+	articles, err := s.selectArticles(args)
 	if err != nil {
 		return err
 	}
+
 	c.PrintfLine("224 here it comes")
 	dw := c.DotWriter()
 	defer dw.Close()
+	writeOverview(dw, articles)
+	return nil
+}
+
+// writeOverview writes the overview lines of articles, ending each with
+// a bare LF.
+func writeOverview(w io.Writer, articles []NumberedArticle) {
 	for _, a := range articles {
-		fmt.Fprintf(dw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", a.Num,
-			a.Article.Header.Get("Subject"),
-			a.Article.Header.Get("From"),
-			a.Article.Header.Get("Date"),
-			a.Article.Header.Get("Message-Id"),
-			a.Article.Header.Get("References"),
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", a.Num,
+			overviewField(a.Article.Header.Get("Subject")),
+			overviewField(a.Article.Header.Get("From")),
+			overviewField(a.Article.Header.Get("Date")),
+			overviewField(a.Article.Header.Get("Message-Id")),
+			overviewField(a.Article.Header.Get("References")),
 			a.Article.Bytes, a.Article.Lines)
 	}
+}
+
+// selectArticles resolves the optional message-id or range argument shared
+// by OVER and HDR. Articles selected by message-id are numbered 0.
+func (s *session) selectArticles(args []string) ([]NumberedArticle, error) {
+	switch {
+	case len(args) > 0 && strings.HasPrefix(args[0], "<"):
+		article, err := s.backend.GetArticle(nil, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return []NumberedArticle{{Num: 0, Article: article}}, nil
+	case s.group == nil:
+		return nil, ErrNoGroupSelected
+	case len(args) == 0:
+		if s.article == 0 {
+			return nil, ErrNoCurrentArticle
+		}
+		articles, err := s.backend.GetArticles(s.group, s.article, s.article)
+		if err != nil {
+			return nil, err
+		}
+		if len(articles) == 0 {
+			return nil, ErrNoCurrentArticle
+		}
+		return articles, nil
+	default:
+		from, to, err := parseRange(args[0])
+		if err != nil {
+			return nil, err
+		}
+		articles, err := s.backend.GetArticles(s.group, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if len(articles) == 0 {
+			return nil, ErrNoArticlesInRange
+		}
+		return articles, nil
+	}
+}
+
+// overviewField replaces the characters that would break an overview line.
+func overviewField(v string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(v)
+}
+
+/*
+   Syntax
+     HDR field message-id
+     HDR field range
+     HDR field
+
+   Responses
+
+   First form (message-id specified)
+     225    Headers follow (multi-line)
+     430    No article with that message-id
+
+   Second form (range specified)
+     225    Headers follow (multi-line)
+     412    No newsgroup selected
+     423    No articles in that range
+
+   Third form (current article number used)
+     225    Headers follow (multi-line)
+     412    No newsgroup selected
+     420    Current article number is invalid
+*/
+
+func handleHdr(args []string, s *session, c *textproto.Conn) error {
+	if len(args) < 1 {
+		return ErrSyntax
+	}
+	articles, err := s.selectArticles(args[1:])
+	if err != nil {
+		return err
+	}
+
+	c.PrintfLine("225 Headers follow")
+	dw := c.DotWriter()
+	defer dw.Close()
+	for _, a := range articles {
+		fmt.Fprintf(dw, "%d %s\n", a.Num, headerValue(a.Article, args[0]))
+	}
+	return nil
+}
+
+// handleXHdr is the RFC 2980 predecessor of HDR. It answers with 221 and
+// identifies articles requested by message-id with that message-id.
+func handleXHdr(args []string, s *session, c *textproto.Conn) error {
+	if len(args) < 1 {
+		return ErrSyntax
+	}
+	articles, err := s.selectArticles(args[1:])
+	if err != nil {
+		return err
+	}
+
+	c.PrintfLine("221 Header follows")
+	dw := c.DotWriter()
+	defer dw.Close()
+	for _, a := range articles {
+		if a.Num == 0 {
+			fmt.Fprintf(dw, "%s %s\n", a.Article.MessageID(), headerValue(a.Article, args[0]))
+			continue
+		}
+		fmt.Fprintf(dw, "%d %s\n", a.Num, headerValue(a.Article, args[0]))
+	}
 	return nil
 }
 
+// headerValue returns a header or a :bytes/:lines metadata item of article.
+func headerValue(article *Article, field string) string {
+	switch strings.ToLower(field) {
+	case ":bytes":
+		return strconv.Itoa(article.Bytes)
+	case ":lines":
+		return strconv.Itoa(article.Lines)
+	}
+	return overviewField(article.Header.Get(field))
+}
+
+func handleListHeaders(c *textproto.Conn) error {
+	err := c.PrintfLine("215 Field list follows")
+	if err != nil {
+		return err
+	}
+	dw := c.DotWriter()
+	defer dw.Close()
+	_, err = fmt.Fprintln(dw, `:
+:bytes
+:lines`)
+	return err
+}
+
 func handleListOverviewFmt(c *textproto.Conn) error {
 	err := c.PrintfLine("215 Order of fields in overview database.")
 	if err != nil {
@@ -379,24 +959,35 @@ func handleList(args []string, s *session, c *textproto.Conn) error {
 	if ltype == "overview.fmt" {
 		return handleListOverviewFmt(c)
 	}
+	if ltype == "headers" {
+		return handleListHeaders(c)
+	}
 
 	groups, err := s.backend.ListGroups(-1)
 	if err != nil {
 		return err
 	}
-	c.PrintfLine("215 list of newsgroups follows")
-	dw := c.DotWriter()
-	defer dw.Close()
+	var lines []string
 	for _, g := range groups {
 		switch ltype {
 		case "active":
-			fmt.Fprintf(dw, "%s %d %d %v\r\n",
-				g.Name, g.High, g.Low, g.Posting)
+			lines = append(lines, fmt.Sprintf("%s %d %d %v", g.Name, g.High, g.Low, g.Posting))
 		case "newsgroups":
-			fmt.Fprintf(dw, "%s %s\r\n", g.Name, g.Description)
+			lines = append(lines, fmt.Sprintf("%s %s", g.Name, g.Description))
 		}
 	}
 
+	c.PrintfLine("215 list of newsgroups follows")
+	if len(lines) == 0 {
+		// An empty DotWriter would emit a blank line before the dot
+		return c.PrintfLine(".")
+	}
+	dw := c.DotWriter()
+	defer dw.Close()
+	for _, l := range lines {
+		fmt.Fprintf(dw, "%s\r\n", l)
+	}
+
 	return nil
 }
 
@@ -429,53 +1020,140 @@ func handleGroup(args []string, s *session, c *textproto.Conn) error {
 		return err
 	}
 
-	s.group = group
+	s.selectGroup(group)
 
 	c.PrintfLine("211 %d %d %d %s",
 		group.Count, group.Low, group.High, group.Name)
 	return nil
 }
 
+/*
+   Syntax
+     LISTGROUP [group [range]]
+
+   Responses
+     211 number low high group     Article numbers follow (multi-line)
+     411                           No such newsgroup
+     412                           No newsgroup selected [1]
+
+   [1] The 412 response can only occur if no group has been specified.
+*/
+
+func handleListGroup(args []string, s *session, c *textproto.Conn) error {
+	group := s.group
+	if len(args) > 0 {
+		var err error
+		group, err = s.backend.GetGroup(args[0])
+		if err != nil {
+			return err
+		}
+	}
+	if group == nil {
+		return ErrNoGroupSelected
+	}
+
+	from, to := int64(0), int64(math.MaxInt64)
+	if len(args) > 1 {
+		var err error
+		if from, to, err = parseRange(args[1]); err != nil {
+			return err
+		}
+	}
+	numbers, err := articleNumbers(s.backend, group, from, to)
+	if err != nil {
+		return err
+	}
+
+	s.selectGroup(group)
+
+	c.PrintfLine("211 %d %d %d %s list follows",
+		group.Count, group.Low, group.High, group.Name)
+	if len(numbers) == 0 {
+		// An empty DotWriter would emit a blank line before the dot
+		return c.PrintfLine(".")
+	}
+	dw := c.DotWriter()
+	defer dw.Close()
+	for _, n := range numbers {
+		fmt.Fprintf(dw, "%d\n", n)
+	}
+	return nil
+}
+
+// selectGroup makes group the current group and points the current
+// article at its first article.
+func (s *session) selectGroup(group *Group) {
+	s.group = group
+	s.article = 0
+	if group.Count > 0 {
+		s.article = group.Low
+	}
+}
+
 func (s *session) getArticle(args []string) (*Article, error) {
-	// If no arguments, need a selected group
+	// If no arguments, need a selected group and a current article
 	if len(args) == 0 {
 		if s.group == nil {
 			return nil, ErrNoGroupSelected
 		}
-		return s.backend.GetArticle(s.group, "")
+		if s.article == 0 {
+			return nil, ErrNoCurrentArticle
+		}
+		article, err := s.backend.GetArticle(s.group, strconv.FormatInt(s.article, 10))
+		if err == ErrInvalidArticleNumber {
+			return nil, ErrNoCurrentArticle
+		}
+		return article, err
 	}
 
 	// If argument is a message-id (starts with '<'), allow without group
 	if strings.HasPrefix(args[0], "<") {
-		return s.backend.GetArticle(nil, args[0])
+		return s.backend.GetArticle(s.group, args[0])
 	}
 
 	// If argument is an article number, require a selected group
 	if s.group == nil {
 		return nil, ErrNoGroupSelected
 	}
-	return s.backend.GetArticle(s.group, args[0])
+	article, err := s.backend.GetArticle(s.group, args[0])
+	if err != nil {
+		return nil, err
+	}
+	s.article = article.Number
+	return article, nil
 }
 
 func (s *session) stat(args []string) (string, string, error) {
-	// If no arguments, need a selected group
+	// If no arguments, need a selected group and a current article
 	if len(args) == 0 {
 		if s.group == nil {
 			return "", "", ErrNoGroupSelected
 		}
-		return s.backend.Stat(s.group, "")
+		if s.article == 0 {
+			return "", "", ErrNoCurrentArticle
+		}
+		number, id, err := s.backend.Stat(s.group, strconv.FormatInt(s.article, 10))
+		if err == ErrInvalidArticleNumber {
+			return "", "", ErrNoCurrentArticle
+		}
+		return number, id, err
 	}
 
 	// If argument is a message-id (starts with '<'), allow without group
 	if strings.HasPrefix(args[0], "<") {
-		return s.backend.Stat(nil, args[0])
+		return s.backend.Stat(s.group, args[0])
 	}
 
 	// If argument is an article number, require a selected group
 	if s.group == nil {
 		return "", "", ErrNoGroupSelected
 	}
-	return s.backend.Stat(s.group, args[0])
+	number, id, err := s.backend.Stat(s.group, args[0])
+	if err != nil {
+		return "", "", err
+	}
+	s.article, _ = strconv.ParseInt(number, 10, 64)
+	return number, id, nil
 }
 
 /*
@@ -506,7 +1184,7 @@ func handleHead(args []string, s *session, c *textproto.Conn) error {
 		return err
 	}
 
-	c.PrintfLine("221 1 %s", article.MessageID())
+	c.PrintfLine("221 %d %s", article.Number, article.MessageID())
 	dw := c.DotWriter()
 	defer dw.Close()
 	for k, v := range article.Header {
@@ -549,11 +1227,8 @@ func handleBody(args []string, s *session, c *textproto.Conn) error {
 		return err
 	}
 
-	c.PrintfLine("222 1 %s", article.MessageID())
-	dw := c.DotWriter()
-	defer dw.Close()
-	_, err = io.Copy(dw, article.Body)
-	return err
+	c.PrintfLine("222 %d %s", article.Number, article.MessageID())
+	return s.writeBody(article, c)
 }
 
 /*
@@ -590,7 +1265,7 @@ func handleArticle(args []string, s *session, c *textproto.Conn) error {
 		return err
 	}
 
-	c.PrintfLine("220 1 %s", article.MessageID())
+	c.PrintfLine("220 %d %s", article.Number, article.MessageID())
 	dw := c.DotWriter()
 	defer dw.Close()
 
@@ -631,6 +1306,8 @@ func handlePost(args []string, s *session, c *textproto.Conn) error {
 	if err != nil {
 		return ErrPostingFailed
 	}
+	// Article numbers are ours to assign
+	article.Header.Del("Xref")
 	article.Body = io.NopCloser(c.DotReader())
 	err = s.backend.Post(&article)
 	if err != nil {
@@ -658,6 +1335,7 @@ func handleIHave(args []string, s *session, c *textproto.Conn) error {
 	if err != nil {
 		return ErrPostingFailed
 	}
+	article.Header.Del("Xref")
 	article.Body = io.NopCloser(c.DotReader())
 	err = s.backend.Post(article)
 	if err != nil {
@@ -674,17 +1352,47 @@ func handleCap(args []string, s *session, c *textproto.Conn) error {
 
 	fmt.Fprintf(dw, "VERSION 2\n")
 	fmt.Fprintf(dw, "READER\n")
+	if s.user == "" {
+		fmt.Fprintf(dw, "AUTHINFO USER SASL\n")
+		fmt.Fprintf(dw, "SASL PLAIN\n")
+	}
+	if s.server.tlsConfig != nil && !s.tls && !s.compressed && s.user == "" {
+		fmt.Fprintf(dw, "STARTTLS\n")
+	}
+	if s.compressAllowed() {
+		fmt.Fprintf(dw, "COMPRESS DEFLATE\n")
+	}
 	if s.backend.AllowPost() {
 		fmt.Fprintf(dw, "POST\n")
 		fmt.Fprintf(dw, "IHAVE\n")
+		fmt.Fprintf(dw, "STREAMING\n")
 	}
 	fmt.Fprintf(dw, "OVER\n")
 	fmt.Fprintf(dw, "XOVER\n")
-	fmt.Fprintf(dw, "LIST ACTIVE NEWSGROUPS OVERVIEW.FMT\n")
+	fmt.Fprintf(dw, "HDR\n")
+	fmt.Fprintf(dw, "LIST ACTIVE NEWSGROUPS OVERVIEW.FMT HEADERS\n")
 	return nil
 }
 
+/*
+   Syntax
+     MODE READER
+     MODE STREAM
+
+   Responses
+     200    Posting allowed
+     201    Posting prohibited
+     203    Streaming permitted
+*/
+
 func handleMode(args []string, s *session, c *textproto.Conn) error {
+	if len(args) > 0 && strings.EqualFold(args[0], "stream") {
+		if !s.backend.AllowPost() {
+			return ErrCommandUnavailable
+		}
+		return c.PrintfLine("203 Streaming permitted")
+	}
+
 	if s.backend.AllowPost() {
 		c.PrintfLine("200 Posting allowed")
 	} else {
@@ -693,35 +1401,83 @@ func handleMode(args []string, s *session, c *textproto.Conn) error {
 	return nil
 }
 
+/*
+   Syntax
+     AUTHINFO USER username
+     AUTHINFO PASS password
+     AUTHINFO SASL mechanism [initial-response]
+
+   Responses
+     281    Authentication accepted
+     381    Password required [1]
+     383    Continue with SASL exchange [2]
+     481    Authentication failed/rejected
+     482    Authentication commands issued out of sequence
+     502    Command unavailable [3]
+     503    Mechanism not recognized [2]
+     504    Base64 encoding error [2]
+
+   [1] Only valid for AUTHINFO USER.
+   [2] Only valid for AUTHINFO SASL.
+   [3] The client is already authenticated.
+*/
+
 func handleAuthInfo(args []string, s *session, c *textproto.Conn) error {
 	if len(args) < 2 {
 		return ErrSyntax
 	}
-	if strings.ToLower(args[0]) != "user" {
-		return ErrSyntax
+	if s.user != "" {
+		return ErrCommandUnavailable
 	}
 
-	if s.backend.Authorized() {
-		return c.PrintfLine("250 authenticated")
+	switch strings.ToLower(args[0]) {
+	case "user":
+		s.pendingUser = args[1]
+		return c.PrintfLine("381 Password required")
+	case "pass":
+		if s.pendingUser == "" {
+			return ErrAuthOutOfSequence
+		}
+		user := s.pendingUser
+		s.pendingUser = ""
+
+		// Passwords may contain spaces, which split them into several args
+		return s.login(user, strings.Join(args[1:], " "), c)
+	case "sasl":
+		if s.pendingUser != "" {
+			s.pendingUser = ""
+			return ErrAuthOutOfSequence
+		}
+		return handleSASL(args[1:], s, c)
 	}
 
-	c.PrintfLine("350 Continue")
-	a, err := c.ReadLine()
+	return ErrSyntax
+}
+
+// login checks the credentials of user and makes the session theirs.
+func (s *session) login(user, pass string, c *textproto.Conn) error {
+	b, err := s.backend.Authenticate(user, pass)
 	if err != nil {
-		return err
+		return s.authFailed(err)
 	}
-
-	parts := strings.SplitN(a, " ", 3)
-	if strings.ToLower(parts[0]) != "authinfo" || strings.ToLower(parts[1]) != "pass" {
-		return ErrSyntax
+	if !s.server.acquireUser(user) {
+		// Over the user's limit: reject and hang up
+		c.PrintfLine(s.server.userRejection().Error())
+		return io.EOF
 	}
-	b, err := s.backend.Authenticate(args[1], parts[2])
-	if err == nil {
-		c.PrintfLine("250 authenticated")
-		if b != nil {
-			s.backend = b
-		}
+	if b != nil {
+		s.backend = b
 	}
+	s.server.connsMu.Lock()
+	s.user = user
+	s.server.connsMu.Unlock()
+	s.throttle.add(s.server.userBucket(user))
+	return c.PrintfLine("281 Authentication accepted")
+}
+
+// authFailed counts a rejected authentication attempt and returns err.
+func (s *session) authFailed(err error) error {
+	s.server.metrics.authFailures.Inc()
 	return err
 }
 
@@ -734,3 +1490,65 @@ func handleStat(args []string, s *session, c *textproto.Conn) error {
 
 	return err
 }
+
+/*
+   Syntax
+     NEXT
+     LAST
+
+   Responses
+     223 n message-id    Article found
+     412                 No newsgroup selected
+     420                 Current article number is invalid
+     421                 No next article in this group
+     422                 No previous article in this group
+*/
+
+func handleNext(args []string, s *session, c *textproto.Conn) error {
+	if s.group == nil {
+		return ErrNoGroupSelected
+	}
+	if s.article == 0 {
+		return ErrNoCurrentArticle
+	}
+
+	numbers, err := articleNumbers(s.backend, s.group, s.article+1, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+	if len(numbers) == 0 {
+		return ErrNoNextArticle
+	}
+
+	return s.moveTo(numbers[0], c)
+}
+
+func handleLast(args []string, s *session, c *textproto.Conn) error {
+	if s.group == nil {
+		return ErrNoGroupSelected
+	}
+	if s.article == 0 {
+		return ErrNoCurrentArticle
+	}
+
+	numbers, err := articleNumbers(s.backend, s.group, 0, s.article-1)
+	if err != nil {
+		return err
+	}
+	if len(numbers) == 0 {
+		return ErrNoPrevArticle
+	}
+
+	return s.moveTo(numbers[len(numbers)-1], c)
+}
+
+// moveTo sets the current article pointer and reports the new position.
+func (s *session) moveTo(num int64, c *textproto.Conn) error {
+	number, id, err := s.backend.Stat(s.group, strconv.FormatInt(num, 10))
+	if err != nil {
+		return err
+	}
+	s.article = num
+
+	return c.PrintfLine("223 %s %s", number, id)
+}
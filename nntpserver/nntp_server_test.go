@@ -0,0 +1,350 @@
+package nntpserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// plainBackend hides the optional interfaces of the backend it wraps, like
+// a Backend implemented outside this package.
+type plainBackend struct {
+	Backend
+}
+
+func TestListGroup(t *testing.T) {
+	for name, backend := range map[string]func() Backend{
+		"numberer": func() Backend { return NewMemoryBackend() },
+		"plain":    func() Backend { return plainBackend{NewMemoryBackend()} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := serveBackend(t, backend(), Config{})
+			postArticles(t, s.Backend, "foo", "<a1@test>", "<a2@test>", "<a3@test>", "<a4@test>")
+
+			c := dial(t, s)
+			c.check("412", "LISTGROUP")
+
+			for _, tc := range []struct {
+				cmd  string
+				want []string
+			}{
+				{"LISTGROUP foo", []string{"1", "2", "3", "4"}},
+				{"LISTGROUP foo 2-3", []string{"2", "3"}},
+				{"LISTGROUP foo 3-", []string{"3", "4"}},
+				{"LISTGROUP foo 2", []string{"2"}},
+				{"LISTGROUP foo 5-", nil},
+				{"LISTGROUP", []string{"1", "2", "3", "4"}},
+			} {
+				c.check("211 4 1 4 foo", tc.cmd)
+				if got := c.block(); !slices.Equal(got, tc.want) {
+					t.Errorf("%s: got %q, want %q", tc.cmd, got, tc.want)
+				}
+			}
+
+			// LISTGROUP selects the group and its first article
+			c.check("211 0 1 0 bar", "LISTGROUP bar")
+			c.block()
+			c.check("420", "STAT")
+			c.check("211 4 1 4 foo", "LISTGROUP foo 3-4")
+			c.block()
+			c.check("223 1 <a1@test>", "STAT")
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	b := NewMemoryBackend()
+	if err := b.DeleteGroup(DefaultGroup); err != nil {
+		t.Fatal(err)
+	}
+	s := serveBackend(t, b, Config{})
+
+	c := dial(t, s)
+	for _, cmd := range []string{"LIST", "LIST ACTIVE", "LIST NEWSGROUPS", "LIST DISTRIBUTIONS"} {
+		c.check("215", cmd)
+		if got := c.block(); len(got) != 0 {
+			t.Errorf("%s without groups: got %q", cmd, got)
+		}
+	}
+
+	postArticles(t, s.Backend, "foo", "<a1@test>", "<a2@test>")
+	for _, tc := range []struct {
+		cmd  string
+		want []string
+	}{
+		{"LIST", []string{"foo 2 1 y"}},
+		{"LIST NEWSGROUPS", []string{"foo A test group"}},
+		{"LIST DISTRIBUTIONS", nil},
+	} {
+		c.check("215", tc.cmd)
+		if got := c.block(); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.cmd, got, tc.want)
+		}
+	}
+}
+
+func TestOver(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, config Config) {
+		s := startServer(t, config)
+		postArticles(t, s.Backend, "foo", "<a1@test>", "<a2@test>", "<a3@test>")
+
+		c := dial(t, s)
+		c.check("412", "OVER")
+		c.check("412", "XOVER 1-")
+
+		line := func(n int) string {
+			return fmt.Sprintf("%d\tarticle a%d@test\tposter@example.com\t\t<a%d@test>\t\t18\t2", n, n, n)
+		}
+		c.check("211 3 1 3 foo", "GROUP foo")
+		for _, tc := range []struct {
+			cmd  string
+			want []string
+		}{
+			{"OVER", []string{line(1)}},
+			{"OVER 2", []string{line(2)}},
+			{"OVER 2-", []string{line(2), line(3)}},
+			{"XOVER 1-2", []string{line(1), line(2)}},
+			{"XOVER 0-9", []string{line(1), line(2), line(3)}},
+			{"OVER <a3@test>", []string{"0" + line(3)[1:]}},
+		} {
+			c.check("224", tc.cmd)
+			if got := c.block(); !slices.Equal(got, tc.want) {
+				t.Errorf("%s: got %q, want %q", tc.cmd, got, tc.want)
+			}
+		}
+
+		c.check("423", "OVER 4-")
+		c.check("423", "XOVER 3-2")
+		c.check("430", "OVER <none@test>")
+
+		c.check("211 0 1 0 empty", "GROUP empty")
+		c.check("420", "OVER")
+		c.check("420", "XOVER")
+	})
+}
+
+func TestPostNumbering(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, config Config) {
+		s := startServer(t, config)
+
+		c := dial(t, s)
+		c.post("Message-Id: <p1@test>\nNewsgroups: a\nSubject: one", "body")
+		c.post("Message-Id: <p2@test>\nNewsgroups: a, b\nSubject: two", "body")
+		c.post("Message-Id: <p3@test>\nNewsgroups: b\nXref: elsewhere b:40\nSubject: three", "body")
+
+		// Neither duplicates nor articles without a message-id are numbered
+		c.check("340", "POST")
+		c.check("441", "Message-Id: <p1@test>\r\nNewsgroups: a\r\n\r\nagain\r\n.")
+		c.check("340", "POST")
+		c.check("441", "Newsgroups: a, b\r\nSubject: no id\r\n\r\nbody\r\n.")
+		if err := s.Backend.Post(&Article{
+			Header: textproto.MIMEHeader{"Newsgroups": {"a"}},
+			Body:   strings.NewReader("body\n"),
+		}); err != ErrPostingFailed {
+			t.Errorf("posting without a message-id: got %v, want %v", err, ErrPostingFailed)
+		}
+
+		c.check("211 2 1 2 a", "GROUP a")
+		c.check("223 1 <p1@test>", "STAT 1")
+		c.check("223 2 <p2@test>", "STAT 2")
+		c.check("211 2 1 2 b", "GROUP b")
+		c.check("223 1 <p2@test>", "STAT 1")
+		c.check("223 2 <p3@test>", "STAT 2")
+		c.check("221 1 <p2@test>", "HEAD <p2@test>")
+		c.block()
+
+		// An Xref header pins the numbers of stored articles
+		if err := s.Backend.Post(&Article{
+			Header: textproto.MIMEHeader{
+				"Message-Id": {"<x1@test>"},
+				"Xref":       {"elsewhere a:10 c:5"},
+			},
+			Body: strings.NewReader("body\n"),
+		}); err != nil {
+			t.Fatalf("posting with Xref: %v", err)
+		}
+		c.post("Message-Id: <p4@test>\nNewsgroups: a, c\nSubject: four", "body")
+		c.check("211 4 1 11 a", "GROUP a")
+		c.check("223 10 <x1@test>", "STAT 10")
+		c.check("223 11 <p4@test>", "STAT 11")
+		c.check("211 2 5 6 c", "GROUP c")
+		c.check("223 6 <p4@test>", "STAT 6")
+	})
+}
+
+func TestNextLast(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, config Config) {
+		s := startServer(t, config)
+		for _, n := range []int{1, 3, 7} {
+			if err := s.Backend.Post(&Article{
+				Header: textproto.MIMEHeader{
+					"Message-Id": {fmt.Sprintf("<n%d@test>", n)},
+					"Xref":       {fmt.Sprintf("elsewhere foo:%d", n)},
+				},
+				Body: strings.NewReader("body\n"),
+			}); err != nil {
+				t.Fatalf("posting article %d: %v", n, err)
+			}
+		}
+
+		c := dial(t, s)
+		c.check("412", "NEXT")
+		c.check("412", "LAST")
+
+		c.check("211 3 1 7 foo", "GROUP foo")
+		c.check("422", "LAST")
+		c.check("223 3 <n3@test>", "NEXT")
+		c.check("223 7 <n7@test>", "NEXT")
+		c.check("421", "NEXT")
+		c.check("223 7 <n7@test>", "STAT")
+		c.check("223 3 <n3@test>", "LAST")
+
+		// Selecting by number moves the pointer, by message-id doesn't
+		c.check("223 7 <n7@test>", "STAT 7")
+		c.check("223 1 <n1@test>", "STAT <n1@test>")
+		c.check("223 7 <n7@test>", "STAT")
+		c.check("423", "STAT 5")
+		c.check("223 7 <n7@test>", "STAT")
+		c.check("220 1 <n1@test>", "ARTICLE 1")
+		c.block()
+		c.check("223 3 <n3@test>", "NEXT")
+
+		// A new group resets the pointer
+		c.check("211 0 1 0 empty", "GROUP empty")
+		c.check("420", "NEXT")
+		c.check("420", "LAST")
+		c.check("420", "STAT")
+		c.check("211 3 1 7 foo", "GROUP foo")
+		c.check("223 1 <n1@test>", "STAT")
+	})
+}
+
+func TestHdr(t *testing.T) {
+	s := startServer(t, Config{})
+	postArticles(t, s.Backend, "foo", "<a1@test>", "<a2@test>", "<a3@test>")
+
+	c := dial(t, s)
+	c.check("215", "LIST HEADERS")
+	if got := c.block(); !slices.Equal(got, []string{":", ":bytes", ":lines"}) {
+		t.Errorf("LIST HEADERS: got %q", got)
+	}
+
+	c.check("501", "HDR")
+	c.check("412", "HDR Subject")
+	c.check("412", "XHDR Subject 1-")
+
+	c.check("211", "GROUP foo")
+	for _, tc := range []struct {
+		cmd, status string
+		want        []string
+	}{
+		{"HDR Subject", "225", []string{"1 article a1@test"}},
+		{"HDR subject 2-", "225", []string{"2 article a2@test", "3 article a3@test"}},
+		{"HDR :bytes 1-2", "225", []string{"1 18", "2 18"}},
+		{"HDR :lines 3", "225", []string{"3 2"}},
+		{"HDR X-Missing 1-2", "225", []string{"1 ", "2 "}},
+		{"HDR Subject <a2@test>", "225", []string{"0 article a2@test"}},
+		{"XHDR From 2-3", "221", []string{"2 poster@example.com", "3 poster@example.com"}},
+		{"XHDR Subject <a3@test>", "221", []string{"<a3@test> article a3@test"}},
+	} {
+		c.check(tc.status, tc.cmd)
+		if got := c.block(); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.cmd, got, tc.want)
+		}
+	}
+
+	c.check("423", "HDR Subject 4-")
+	c.check("430", "XHDR Subject <none@test>")
+}
+
+func TestCloseWithIdleClient(t *testing.T) {
+	for _, timeout := range []time.Duration{0, 100 * time.Millisecond} {
+		s := startServer(t, Config{ShutdownTimeout: timeout})
+		c := dial(t, s)
+		c.check("211", "GROUP foo")
+
+		start := time.Now()
+		err := s.Close()
+		took := time.Since(start)
+		switch {
+		case timeout == 0 && err != nil:
+			t.Errorf("Close: %v", err)
+		case timeout > 0 && err != context.DeadlineExceeded:
+			t.Errorf("Close after %v: got %v, want %v", timeout, err, context.DeadlineExceeded)
+		case took < timeout || took > timeout+time.Second:
+			t.Errorf("Close after %v took %v", timeout, took)
+		}
+		if _, err := c.ReadLine(); err == nil {
+			t.Errorf("connection still open after Close")
+		}
+	}
+}
+
+func TestCloseWhileConnecting(t *testing.T) {
+	for range 20 {
+		s := startServer(t, Config{})
+		addr := s.Addr().String()
+
+		stop := make(chan struct{})
+		dialed := make(chan struct{})
+		go func() {
+			defer close(dialed)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if nc, err := net.Dial("tcp", addr); err == nil {
+					// Hold the connection without a command
+					defer nc.Close()
+				}
+			}
+		}()
+		time.Sleep(5 * time.Millisecond)
+
+		closed := make(chan error)
+		go func() { closed <- s.Close() }()
+		select {
+		case err := <-closed:
+			if err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Close hangs with connections arriving")
+		}
+		close(stop)
+		<-dialed
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	s := startServer(t, Config{IdleTimeout: 50 * time.Millisecond})
+
+	c := dial(t, s)
+	c.check("211", "GROUP foo")
+	c.expect("400 Idle timeout")
+	if _, err := c.ReadLine(); err == nil {
+		t.Error("connection still open after the idle timeout")
+	}
+}
+
+func TestRangeSyntax(t *testing.T) {
+	s := startServer(t, Config{})
+	postArticles(t, s.Backend, "foo", "<a1@test>", "<a2@test>")
+
+	c := dial(t, s)
+	c.check("211", "GROUP foo")
+	for _, spec := range []string{"abc", "5-x", "x-5", "-5", "1-2-3"} {
+		for _, cmd := range []string{"OVER", "XOVER", "HDR Subject", "XHDR Subject", "LISTGROUP foo"} {
+			c.check("501", "%s %s", cmd, spec)
+		}
+	}
+	// The group stays selected
+	c.check("223 1 <a1@test>", "STAT")
+}
@@ -0,0 +1,272 @@
+package nntpserver
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/javi11/nntp-server-mock/yenc"
+)
+
+const nzbNamespace = "http://www.newzbin.com/DTD/2003/nzb"
+
+const nzbDoctype = `<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">`
+
+// NZB is the job description Usenet downloaders work from: the files of a
+// post and the message-ids of their segments.
+type NZB struct {
+	XMLName xml.Name  `xml:"nzb"`
+	Xmlns   string    `xml:"xmlns,attr,omitempty"`
+	Head    *NZBHead  `xml:"head,omitempty"`
+	Files   []NZBFile `xml:"file"`
+}
+
+type NZBHead struct {
+	Meta []NZBMeta `xml:"meta"`
+}
+
+type NZBMeta struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type NZBFile struct {
+	Poster   string       `xml:"poster,attr"`
+	Date     int64        `xml:"date,attr"`
+	Subject  string       `xml:"subject,attr"`
+	Groups   []string     `xml:"groups>group"`
+	Segments []NZBSegment `xml:"segments>segment"`
+}
+
+// NZBSegment is one article of a file. ID is the message-id without the
+// angle brackets.
+type NZBSegment struct {
+	Bytes  int64  `xml:"bytes,attr"`
+	Number int    `xml:"number,attr"`
+	ID     string `xml:",chardata"`
+}
+
+// NZBSource is an NZB to import and the directory holding its files.
+type NZBSource struct {
+	File string `yaml:"file"`
+	// Directory of the source files (defaults to the directory of File)
+	Dir string `yaml:"dir"`
+}
+
+// ParseNZB reads an NZB document.
+func ParseNZB(r io.Reader) (*NZB, error) {
+	var nzb NZB
+	if err := xml.NewDecoder(r).Decode(&nzb); err != nil {
+		return nil, fmt.Errorf("parsing nzb: %w", err)
+	}
+	return &nzb, nil
+}
+
+// WriteTo writes the NZB document to w.
+func (n *NZB) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(nzbDoctype + "\n")
+
+	doc := *n
+	if doc.Xmlns == "" {
+		doc.Xmlns = nzbNamespace
+	}
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&doc); err != nil {
+		return 0, err
+	}
+	buf.WriteString("\n")
+
+	return buf.WriteTo(w)
+}
+
+// partPattern matches the "(1/N)" part counter of a subject.
+var partPattern = regexp.MustCompile(`\((\d+)/(\d+)\)([^()]*)$`)
+
+// fileNamePattern matches the quoted file name of a subject.
+var fileNamePattern = regexp.MustCompile(`"([^"]+)"`)
+
+// partSubject returns subject with its part counter set to part/total.
+func partSubject(subject string, part, total int) string {
+	counter := fmt.Sprintf("(%d/%d)", part, total)
+	if partPattern.MatchString(subject) {
+		return partPattern.ReplaceAllString(subject, counter+"$3")
+	}
+	return subject + " " + counter
+}
+
+// ImportNZB posts the segments of every file in the NZB, yEnc encoding the
+// matching file from dir. Files are found by the quoted name in their
+// subject and split evenly over their segments. It returns the number of
+// articles posted, segments already stored are skipped.
+func ImportNZB(backend Backend, nzb *NZB, dir string) (int, error) {
+	posted := 0
+	for _, file := range nzb.Files {
+		m := fileNamePattern.FindStringSubmatch(file.Subject)
+		if m == nil {
+			return posted, fmt.Errorf("importing nzb: no file name in subject %q", file.Subject)
+		}
+		name := m[1]
+
+		data, err := os.ReadFile(filepath.Join(dir, filepath.Base(name)))
+		if err != nil {
+			return posted, fmt.Errorf("importing nzb: %w", err)
+		}
+
+		segments := append([]NZBSegment(nil), file.Segments...)
+		sort.Slice(segments, func(i, j int) bool {
+			return segments[i].Number < segments[j].Number
+		})
+		total := len(segments)
+		if total == 0 {
+			continue
+		}
+		parts := yenc.SplitN(name, data, total)
+		if len(parts) != total {
+			return posted, fmt.Errorf("importing nzb: cannot split %s (%d bytes) into %d segments", name, len(data), total)
+		}
+
+		for i, seg := range segments {
+			header := textproto.MIMEHeader{}
+			header.Set("Message-Id", "<"+strings.Trim(strings.TrimSpace(seg.ID), "<>")+">")
+			header.Set("Newsgroups", strings.Join(file.Groups, ","))
+			header.Set("Subject", partSubject(file.Subject, i+1, total))
+			if file.Poster != "" {
+				header.Set("From", file.Poster)
+			}
+			if file.Date > 0 {
+				header.Set("Date", time.Unix(file.Date, 0).UTC().Format(time.RFC1123Z))
+			}
+
+			var body bytes.Buffer
+			if err := parts[i].Encode(&body, yenc.DefaultLineLength); err != nil {
+				return posted, err
+			}
+			err := backend.Post(&Article{Header: header, Body: &body})
+			if err == ErrDuplicateArticle {
+				continue
+			}
+			if err != nil {
+				return posted, fmt.Errorf("importing nzb: posting segment %d of %s: %w", seg.Number, name, err)
+			}
+			posted++
+		}
+	}
+
+	return posted, nil
+}
+
+// ImportNZBFile loads source.File and imports it, see ImportNZB.
+func ImportNZBFile(backend Backend, source NZBSource) (int, error) {
+	f, err := os.Open(source.File)
+	if err != nil {
+		return 0, fmt.Errorf("importing nzb: %w", err)
+	}
+	defer f.Close()
+
+	nzb, err := ParseNZB(f)
+	if err != nil {
+		return 0, err
+	}
+
+	dir := source.Dir
+	if dir == "" {
+		dir = filepath.Dir(source.File)
+	}
+	return ImportNZB(backend, nzb, dir)
+}
+
+// GroupNZB returns an NZB listing every article of the named group.
+func GroupNZB(backend Backend, name string) (*NZB, error) {
+	group, err := backend.GetGroup(name)
+	if err != nil {
+		return nil, err
+	}
+	numbered, err := backend.GetArticles(group, group.Low, group.High)
+	if err != nil {
+		return nil, err
+	}
+
+	articles := make([]*Article, len(numbered))
+	for i, na := range numbered {
+		articles[i] = na.Article
+	}
+	return articlesNZB(articles), nil
+}
+
+// ArticlesNZB returns an NZB listing the articles with the given
+// message-ids.
+func ArticlesNZB(backend Backend, ids []string) (*NZB, error) {
+	articles := make([]*Article, 0, len(ids))
+	for _, id := range ids {
+		article, err := backend.GetArticle(nil, id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", id, err)
+		}
+		articles = append(articles, article)
+	}
+	return articlesNZB(articles), nil
+}
+
+// articlesNZB groups articles into files by their subject minus the part
+// counter, keeping the order in which files first appear.
+func articlesNZB(articles []*Article) *NZB {
+	nzb := &NZB{}
+	files := map[string]int{}
+
+	for _, article := range articles {
+		subject := article.Header.Get("Subject")
+		key, part := subject, 1
+		if m := partPattern.FindStringSubmatch(subject); m != nil {
+			key = partPattern.ReplaceAllString(subject, "$3")
+			part, _ = strconv.Atoi(m[1])
+		}
+
+		i, ok := files[key]
+		if !ok {
+			i = len(nzb.Files)
+			files[key] = i
+
+			file := NZBFile{
+				Poster:  article.Header.Get("From"),
+				Subject: subject,
+				Groups:  article.Newsgroups(),
+			}
+			if date, err := mail.ParseDate(article.Header.Get("Date")); err == nil {
+				file.Date = date.Unix()
+			}
+			nzb.Files = append(nzb.Files, file)
+		}
+
+		file := &nzb.Files[i]
+		if part == 1 {
+			file.Subject = subject
+		}
+		file.Segments = append(file.Segments, NZBSegment{
+			Bytes:  int64(article.Bytes),
+			Number: part,
+			ID:     strings.Trim(article.MessageID(), "<>"),
+		})
+	}
+
+	for i := range nzb.Files {
+		segments := nzb.Files[i].Segments
+		sort.SliceStable(segments, func(a, b int) bool {
+			return segments[a].Number < segments[b].Number
+		})
+	}
+
+	return nzb
+}
@@ -0,0 +1,150 @@
+package nntpserver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestImportNZB(t *testing.T) {
+	s := startServer(t, Config{NZBs: []NZBSource{{File: "testdata/nzb/job.nzb"}}})
+
+	if n, err := ImportNZBFile(s.Backend, NZBSource{File: "testdata/nzb/job.nzb"}); err != nil || n != 0 {
+		t.Errorf("importing again: got %d, %v, want 0 articles", n, err)
+	}
+
+	c := dial(t, s)
+	c.check("211 4 1 4 alt.binaries.test", "GROUP alt.binaries.test")
+	c.check("211 3 1 3 alt.binaries.other", "GROUP alt.binaries.other")
+
+	for _, tc := range []struct {
+		file, subject string
+		ids           []string
+	}{
+		{"movie.bin", `Test post [1/2] - "movie.bin" yEnc`, []string{"<movie.1@test>", "<movie.2@test>", "<movie.3@test>"}},
+		{"notes.txt", `Test post [2/2] - "notes.txt" yEnc`, []string{"<notes.1@test>"}},
+	} {
+		want, err := os.ReadFile(filepath.Join("testdata/nzb", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The file is split evenly over the segments in number order
+		var got []byte
+		for i, id := range tc.ids {
+			c.check("221", "HEAD %s", id)
+			header := c.block()
+			subject := partSubject(tc.subject, i+1, len(tc.ids))
+			if !slices.Contains(header, "Subject: "+subject) {
+				t.Errorf("%s: header %q, want subject %q", id, header, subject)
+			}
+
+			c.check("222", "BODY %s", id)
+			lines := c.block()
+			if len(tc.ids) > 1 {
+				// Drop the =ypart line of multi-part bodies
+				lines = slices.Delete(lines, 1, 2)
+			}
+			part := yencData(t, lines)
+			if size := (len(want) + len(tc.ids) - 1) / len(tc.ids); i < len(tc.ids)-1 && len(part) != size {
+				t.Errorf("%s: %d bytes, want %d", id, len(part), size)
+			}
+			got = append(got, part...)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: segments hold %d bytes that differ from the file", tc.file, len(got))
+		}
+	}
+}
+
+func TestImportNZBErrors(t *testing.T) {
+	nzb := func(subject string, segments int) *NZB {
+		file := NZBFile{Subject: subject, Groups: []string{"foo"}}
+		for i := range segments {
+			file.Segments = append(file.Segments, NZBSegment{Number: i + 1, ID: "s" + strings.Repeat("x", i) + "@test"})
+		}
+		return &NZB{Files: []NZBFile{file}}
+	}
+
+	for _, tc := range []struct {
+		name string
+		nzb  *NZB
+	}{
+		{"no file name", nzb("no quotes (1/1)", 1)},
+		{"missing file", nzb(`"none.bin" (1/1)`, 1)},
+		// 24 bytes can't make 30 segments
+		{"too many segments", nzb(`"notes.txt" (1/30)`, 30)},
+	} {
+		b := NewMemoryBackend()
+		if _, err := ImportNZB(b, tc.nzb, "testdata/nzb"); err == nil {
+			t.Errorf("%s: ImportNZB succeeded", tc.name)
+		}
+		b.Close()
+	}
+
+	if _, err := ParseNZB(strings.NewReader("<nzb><file>")); err == nil {
+		t.Error("ParseNZB accepted a truncated document")
+	}
+}
+
+func TestExportNZB(t *testing.T) {
+	b := NewMemoryBackend()
+	defer b.Close()
+	f, err := os.Open("testdata/nzb/job.nzb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	job, err := ParseNZB(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ImportNZB(b, job, "testdata/nzb"); err != nil || n != 4 {
+		t.Fatalf("ImportNZB: got %d, %v, want 4 articles", n, err)
+	}
+
+	exported, err := GroupNZB(b, "alt.binaries.test")
+	if err != nil {
+		t.Fatalf("GroupNZB: %v", err)
+	}
+
+	// The export parses back to the files of the job, segments in order
+	var buf bytes.Buffer
+	if _, err := exported.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	got, err := ParseNZB(&buf)
+	if err != nil {
+		t.Fatalf("parsing the export: %v", err)
+	}
+	if len(got.Files) != len(job.Files) {
+		t.Fatalf("got %d files, want %d", len(got.Files), len(job.Files))
+	}
+	for i, file := range got.Files {
+		want := job.Files[i]
+		if file.Subject != want.Subject || file.Poster != want.Poster || file.Date != want.Date ||
+			!slices.Equal(file.Groups, want.Groups) {
+			t.Errorf("file %d: got %+v, want %+v", i, file, want)
+		}
+		for n, seg := range file.Segments {
+			j := slices.IndexFunc(want.Segments, func(s NZBSegment) bool { return s.Number == n+1 })
+			if seg.Number != n+1 || j < 0 || seg.ID != want.Segments[j].ID || seg.Bytes == 0 {
+				t.Errorf("%s: segment %d is %+v", want.Subject, n+1, seg)
+			}
+		}
+	}
+
+	byID, err := ArticlesNZB(b, []string{"<notes.1@test>"})
+	if err != nil {
+		t.Fatalf("ArticlesNZB: %v", err)
+	}
+	if len(byID.Files) != 1 || byID.Files[0].Subject != job.Files[1].Subject {
+		t.Errorf("ArticlesNZB: got %+v", byID.Files)
+	}
+	if _, err := ArticlesNZB(b, []string{"<none@test>"}); err == nil {
+		t.Error("ArticlesNZB found an unknown article")
+	}
+}
@@ -0,0 +1,121 @@
+package nntpserver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"net/textproto"
+	"strings"
+
+	"github.com/javi11/nntp-server-mock/yenc"
+)
+
+/*
+   Syntax
+     XFEATURE COMPRESS GZIP [TERMINATOR]
+
+   Responses
+     290    Feature enabled
+     501    Syntax error or unknown feature
+
+   Once enabled, the data of every XOVER response is sent as one zlib
+   stream holding the dot-terminated lines, and the status line is
+   marked [COMPRESS=GZIP]. With TERMINATOR a plain ".\r\n" follows the
+   stream.
+*/
+
+func handleXFeature(args []string, s *session, c *textproto.Conn) error {
+	if len(args) < 2 || len(args) > 3 ||
+		!strings.EqualFold(args[0], "compress") || !strings.EqualFold(args[1], "gzip") {
+		return ErrSyntax
+	}
+	terminator := false
+	if len(args) == 3 {
+		if !strings.EqualFold(args[2], "terminator") {
+			return ErrSyntax
+		}
+		terminator = true
+	}
+
+	s.gzipOverview = true
+	s.gzipTerminator = terminator
+	return c.PrintfLine("290 feature enabled")
+}
+
+func handleXOver(args []string, s *session, c *textproto.Conn) error {
+	if !s.gzipOverview {
+		return handleOver(args, s, c)
+	}
+
+	articles, err := s.selectArticles(args)
+	if err != nil {
+		return err
+	}
+
+	// Dot-stuff and terminate the lines first, the stream carries both
+	var text bytes.Buffer
+	bw := bufio.NewWriter(&text)
+	dw := textproto.NewWriter(bw).DotWriter()
+	writeOverview(dw, articles)
+	dw.Close()
+
+	var data bytes.Buffer
+	zw := zlib.NewWriter(&data)
+	zw.Write(text.Bytes())
+	zw.Close()
+
+	c.PrintfLine("224 here it comes [COMPRESS=GZIP]")
+	c.W.Write(data.Bytes())
+	if s.gzipTerminator {
+		c.W.WriteString(".\r\n")
+	}
+	return c.W.Flush()
+}
+
+/*
+   Syntax
+     XZVER [range]
+     XZVER message-id
+
+   Responses
+     224    Overview information follows (multi-line)
+
+   The same as XOVER, except that the data is the overview lines, CRLF
+   terminated, compressed with raw DEFLATE and sent as a single-part yEnc
+   block.
+*/
+
+func handleXZVer(args []string, s *session, c *textproto.Conn) error {
+	articles, err := s.selectArticles(args)
+	if err != nil {
+		return err
+	}
+
+	var text bytes.Buffer
+	for _, line := range overviewLines(articles) {
+		text.WriteString(line)
+		text.WriteString("\r\n")
+	}
+
+	var data bytes.Buffer
+	fw, err := flate.NewWriter(&data, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	fw.Write(text.Bytes())
+	fw.Close()
+
+	c.PrintfLine("224 compressed data follows (yEnc, raw DEFLATE)")
+	dw := c.DotWriter()
+	defer dw.Close()
+	return yenc.Split("xzver", data.Bytes(), 0)[0].Encode(dw, yenc.DefaultLineLength)
+}
+
+// overviewLines returns the overview lines of articles without line
+// endings.
+func overviewLines(articles []NumberedArticle) []string {
+	var buf bytes.Buffer
+	writeOverview(&buf, articles)
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
@@ -0,0 +1,94 @@
+package nntpserver
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+)
+
+// yencData decodes the data lines of a single-part yEnc block.
+func yencData(t *testing.T, lines []string) []byte {
+	t.Helper()
+
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "=ybegin ") ||
+		!strings.HasPrefix(lines[len(lines)-1], "=yend ") {
+		t.Fatalf("not a yEnc block: %q", lines)
+	}
+	var data []byte
+	for _, line := range lines[1 : len(lines)-1] {
+		for i := 0; i < len(line); i++ {
+			b := line[i]
+			if b == '=' {
+				i++
+				b = line[i] - 64
+			}
+			data = append(data, b-42)
+		}
+	}
+	return data
+}
+
+func TestXZVer(t *testing.T) {
+	s := startServer(t, Config{})
+	postArticles(t, s.Backend, "foo", "<a1@test>", "<a2@test>", "<a3@test>")
+
+	c := dial(t, s)
+	c.check("211", "GROUP foo")
+	c.check("224 compressed data follows (yEnc, raw DEFLATE)", "XZVER 2-")
+
+	text, err := io.ReadAll(flate.NewReader(bytes.NewReader(yencData(t, c.block()))))
+	if err != nil {
+		t.Fatalf("inflating: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(text), "\r\n"), "\r\n")
+	if len(lines) != 2 ||
+		!strings.HasPrefix(lines[0], "2\tarticle a2@test\t") ||
+		!strings.HasPrefix(lines[1], "3\tarticle a3@test\t") {
+		t.Fatalf("got overview %q", lines)
+	}
+
+	c.check("423", "XZVER 4-")
+}
+
+func TestXFeatureCompressGzip(t *testing.T) {
+	for _, terminator := range []bool{false, true} {
+		s := startServer(t, Config{})
+		postArticles(t, s.Backend, "foo", "<a1@test>", "<a2@test>")
+
+		c := dial(t, s)
+		c.check("211", "GROUP foo")
+		if terminator {
+			c.check("290", "XFEATURE COMPRESS GZIP TERMINATOR")
+		} else {
+			c.check("290", "XFEATURE COMPRESS GZIP")
+		}
+		c.check("224 here it comes [COMPRESS=GZIP]", "XOVER 1-2")
+
+		zr, err := zlib.NewReader(c.R)
+		if err != nil {
+			t.Fatalf("zlib stream: %v", err)
+		}
+		text, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("inflating: %v", err)
+		}
+		lines := strings.Split(string(text), "\r\n")
+		if len(lines) != 4 || lines[2] != "." || lines[3] != "" ||
+			!strings.HasPrefix(lines[0], "1\tarticle a1@test\t") ||
+			!strings.HasPrefix(lines[1], "2\tarticle a2@test\t") {
+			t.Fatalf("got %q", lines)
+		}
+		if terminator {
+			c.expect(".")
+		}
+
+		// OVER is left uncompressed
+		c.check("224", "OVER 2")
+		if got := c.block(); len(got) != 1 || !strings.HasPrefix(got[0], "2\t") {
+			t.Fatalf("OVER 2: got %q", got)
+		}
+	}
+}
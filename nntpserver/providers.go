@@ -0,0 +1,151 @@
+package nntpserver
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ProviderConfig describes one provider started by StartProviders. The
+// embedded Config holds its server options; the storage fields come from
+// the shared store instead, and Retention only hides articles from this
+// provider.
+type ProviderConfig struct {
+	Config `yaml:",inline"`
+	// Name seeding the choice of missing articles (defaults to the
+	// provider's position)
+	Name string `yaml:"name"`
+	// Fraction (0-1) of the stored articles this provider doesn't have
+	MissingFraction float64 `yaml:"missing_fraction"`
+}
+
+// Providers is a set of servers simulating Usenet providers with their
+// own view of one shared article store.
+type Providers struct {
+	Servers []*Server
+	Store   Backend
+}
+
+// StartProviders creates the store described by the storage fields of
+// base, then creates and starts a server on top of it for every provider.
+func StartProviders(base Config, providers []ProviderConfig) (*Providers, error) {
+	store, err := newBackend(base)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Providers{Store: store}
+	for i, pc := range providers {
+		name := pc.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+
+		view := &providerView{Backend: store, seed: name, missing: pc.MissingFraction}
+		view.retention.period = pc.Retention
+		view.retention.now = base.Clock
+
+		s, err := NewServerWithBackend(view, pc.Config)
+		if err == nil {
+			err = s.Start()
+		}
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("provider %s: %w", name, err)
+		}
+		p.Servers = append(p.Servers, s)
+	}
+
+	return p, nil
+}
+
+// Addrs returns the addresses the providers listen on, in order.
+func (p *Providers) Addrs() []string {
+	addrs := make([]string, len(p.Servers))
+	for i, s := range p.Servers {
+		addrs[i] = s.Addr().String()
+	}
+	return addrs
+}
+
+// Close stops every provider, then closes the shared store.
+func (p *Providers) Close() error {
+	var errs []error
+	for _, s := range p.Servers {
+		errs = append(errs, s.Close())
+	}
+	if closer, ok := p.Store.(interface{ Close() error }); ok {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// providerView hides part of a shared store: a stable pseudo-random
+// fraction of the articles and those past the provider's retention.
+// Group counts and water marks are those of the store.
+type providerView struct {
+	Backend
+	seed      string
+	missing   float64
+	retention retention
+}
+
+func (p *providerView) hidden(article *Article) bool {
+	if p.retention.expired(article.Arrived) {
+		return true
+	}
+	if p.missing <= 0 {
+		return false
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(p.seed))
+	h.Write([]byte(article.MessageID()))
+	return float64(h.Sum64())/math.MaxUint64 < p.missing
+}
+
+func (p *providerView) GetArticle(group *Group, id string) (*Article, error) {
+	article, err := p.Backend.GetArticle(group, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.hidden(article) {
+		if strings.HasPrefix(id, "<") {
+			return nil, ErrInvalidMessageID
+		}
+		return nil, ErrInvalidArticleNumber
+	}
+	return article, nil
+}
+
+func (p *providerView) GetArticles(group *Group, from, to int64) ([]NumberedArticle, error) {
+	articles, err := p.Backend.GetArticles(group, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := articles[:0]
+	for _, na := range articles {
+		if !p.hidden(na.Article) {
+			kept = append(kept, na)
+		}
+	}
+	return kept, nil
+}
+
+func (p *providerView) Stat(group *Group, id string) (string, string, error) {
+	article, err := p.GetArticle(group, id)
+	if err != nil {
+		return "", "", err
+	}
+
+	return strconv.FormatInt(article.Number, 10), article.MessageID(), nil
+}
+
+// Close leaves the shared store open, Providers.Close closes it.
+func (p *providerView) Close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package nntpserver
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProviders(t *testing.T) {
+	clock := newFakeClock()
+	local := Config{Address: "127.0.0.1:0"}
+	p, err := StartProviders(Config{Backend: MemoryBackendType, Clock: clock.Now}, []ProviderConfig{
+		{Config: local, Name: "a", MissingFraction: 0.5},
+		{Config: local, Name: "b", MissingFraction: 0.5},
+		{Config: local, Name: "full"},
+		{Config: withRetention(local, time.Hour), Name: "short"},
+	})
+	if err != nil {
+		t.Fatalf("StartProviders: %v", err)
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			p.Close()
+		}
+	}()
+
+	if addrs := p.Addrs(); len(addrs) != 4 || addrs[0] == addrs[1] {
+		t.Fatalf("got addresses %q", addrs)
+	}
+
+	var ids []string
+	for i := range 200 {
+		ids = append(ids, fmt.Sprintf("<p%d@test>", i))
+	}
+	// The first half is past the retention of provider short
+	postArticles(t, p.Store, "foo", ids[:100]...)
+	clock.advance(2 * time.Hour)
+	postArticles(t, p.Store, "foo", ids[100:]...)
+
+	// present returns the articles a provider has, asking by message-id
+	// and by number.
+	present := func(s *Server) map[string]bool {
+		c := dial(t, s)
+		c.check("211 200 1 200 foo", "GROUP foo")
+		have := map[string]bool{}
+		for i, id := range ids {
+			byID := strings.HasPrefix(c.cmd("STAT %s", id), "223")
+			byNum := strings.HasPrefix(c.cmd("STAT %d", i+1), "223")
+			if byID != byNum {
+				t.Errorf("%s: found by message-id %v, by number %v", id, byID, byNum)
+			}
+			if byID {
+				have[id] = true
+			}
+		}
+		c.check("211", "LISTGROUP")
+		if got := len(c.block()); got != len(have) {
+			t.Errorf("LISTGROUP lists %d articles, STAT finds %d", got, len(have))
+		}
+		return have
+	}
+
+	a, b := present(p.Servers[0]), present(p.Servers[1])
+	for name, have := range map[string]map[string]bool{"a": a, "b": b} {
+		if len(have) < 60 || len(have) > 140 {
+			t.Errorf("provider %s has %d of 200 articles, want about half", name, len(have))
+		}
+	}
+	if maps.Equal(a, b) {
+		t.Error("providers a and b miss the same articles")
+	}
+	if again := present(p.Servers[0]); !maps.Equal(a, again) {
+		t.Error("provider a changed the articles it misses")
+	}
+
+	if got := len(present(p.Servers[2])); got != 200 {
+		t.Errorf("provider full has %d of 200 articles", got)
+	}
+	short := present(p.Servers[3])
+	for i, id := range ids {
+		if short[id] != (i >= 100) {
+			t.Errorf("provider short: has %s = %v", id, short[id])
+		}
+	}
+
+	// Close doesn't wait for idle clients
+	for _, s := range p.Servers {
+		dial(t, s).check("211", "GROUP foo")
+	}
+	done := make(chan error)
+	go func() { done <- p.Close() }()
+	select {
+	case err := <-done:
+		closed = true
+		if err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hangs with clients connected")
+	}
+}
+
+func withRetention(config Config, retention time.Duration) Config {
+	config.Retention = retention
+	return config
+}
@@ -0,0 +1,91 @@
+package nntpserver
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultExpireInterval is how often expired articles are deleted when
+// no interval is configured.
+const DefaultExpireInterval = time.Minute
+
+// retainer is implemented by the backends that support retention.
+type retainer interface {
+	SetClock(now func() time.Time)
+	SetRetention(period, interval time.Duration)
+	Expire() (int, error)
+}
+
+// retention hides articles that arrived more than period ago and runs the
+// job deleting them. The owning backend guards period and now with its lock.
+type retention struct {
+	period time.Duration
+	now    func() time.Time
+
+	jobMu sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func (r *retention) time() time.Time {
+	if r.now == nil {
+		return time.Now()
+	}
+	return r.now()
+}
+
+// cutoff returns the arrival time, in unix nanoseconds, before which
+// articles have expired. It is 0 when articles are kept forever.
+func (r *retention) cutoff() int64 {
+	if r.period <= 0 {
+		return 0
+	}
+	return r.time().Add(-r.period).UnixNano()
+}
+
+// expired reports whether an article that arrived at arrived is past
+// retention. Articles of unknown age never are.
+func (r *retention) expired(arrived time.Time) bool {
+	return r.period > 0 && !arrived.IsZero() && arrived.Before(r.time().Add(-r.period))
+}
+
+// start runs expire every interval until stopJob, replacing a running job.
+func (r *retention) start(interval time.Duration, expire func()) {
+	r.stopJob()
+
+	r.jobMu.Lock()
+	defer r.jobMu.Unlock()
+
+	if interval <= 0 {
+		interval = DefaultExpireInterval
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	r.stop, r.done = stop, done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				expire()
+			}
+		}
+	}()
+}
+
+// stopJob stops the expiry job, if any, and waits for it to return.
+// Callers must not hold the backend lock.
+func (r *retention) stopJob() {
+	r.jobMu.Lock()
+	defer r.jobMu.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+		r.stop, r.done = nil, nil
+	}
+}
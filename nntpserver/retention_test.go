@@ -0,0 +1,149 @@
+package nntpserver
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock tests move by hand.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestRetention(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, config Config) {
+		clock := newFakeClock()
+		config.Clock = clock.Now
+		config.Retention = 150 * time.Minute
+		// Keep the expiry job from deleting articles during the test
+		config.ExpireInterval = time.Hour
+		s := startServer(t, config)
+
+		for _, id := range []string{"<a1@test>", "<a2@test>", "<a3@test>"} {
+			postArticles(t, s.Backend, "foo", id)
+			clock.advance(time.Hour)
+		}
+		// Now 3h after the first article, which is past retention
+
+		c := dial(t, s)
+		c.check("211 2 2 3 foo", "GROUP foo")
+		c.check("223 2 <a2@test>", "STAT")
+		c.check("423", "STAT 1")
+		c.check("430", "STAT <a1@test>")
+		c.check("430", "ARTICLE <a1@test>")
+		c.check("422", "LAST")
+		c.check("224", "OVER 1-3")
+		if got := c.block(); len(got) != 2 {
+			t.Errorf("OVER 1-3: got %d articles, want 2", len(got))
+		}
+		c.check("211", "LISTGROUP foo")
+		if got := c.block(); len(got) != 2 || got[0] != "2" {
+			t.Errorf("LISTGROUP: got %q, want [2 3]", got)
+		}
+
+		clock.advance(40 * time.Minute)
+		c.check("211 1 3 3 foo", "GROUP foo")
+		c.check("423", "STAT 2")
+		c.check("223 3 <a3@test>", "STAT 3")
+
+		// Past retention articles are hidden before they are deleted
+		if ok, _ := hasArticle(s.Backend, "<a1@test>"); !ok {
+			t.Error("article deleted before the expiry job ran")
+		}
+
+		clock.advance(time.Hour)
+		c.check("211 0 4 3 foo", "GROUP foo")
+		c.check("420", "STAT")
+		c.check("423", "OVER 1-")
+
+		// New articles carry on the numbering
+		postArticles(t, s.Backend, "foo", "<a4@test>")
+		c.check("211 1 4 4 foo", "GROUP foo")
+	})
+}
+
+func TestExpireJob(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, config Config) {
+		clock := newFakeClock()
+		config.Clock = clock.Now
+		config.Retention = time.Hour
+		config.ExpireInterval = 5 * time.Millisecond
+		s := startServer(t, config)
+
+		postArticles(t, s.Backend, "foo", "<old@test>")
+		clock.advance(2 * time.Hour)
+		postArticles(t, s.Backend, "foo", "<new@test>")
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			old, err := hasArticle(s.Backend, "<old@test>")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !old {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("expired article not deleted")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if ok, _ := hasArticle(s.Backend, "<new@test>"); !ok {
+			t.Error("article within retention deleted")
+		}
+
+		c := dial(t, s)
+		c.check("211 1 2 2 foo", "GROUP foo")
+		c.check("211", "LISTGROUP foo 1-")
+		if got := c.block(); len(got) != 1 || got[0] != "2" {
+			t.Errorf("LISTGROUP: got %q, want [2]", got)
+		}
+	})
+}
+
+func TestRetentionExpireCount(t *testing.T) {
+	clock := newFakeClock()
+	b := NewMemoryBackend()
+	defer b.Close()
+	b.SetClock(clock.Now)
+
+	postArticles(t, b, "foo", "<a1@test>")
+	// Cross-posted articles are counted once
+	postArticles(t, b, "foo,bar", "<x@test>")
+	clock.advance(time.Hour)
+	postArticles(t, b, "foo", "<a2@test>")
+
+	if n, err := b.Expire(); err != nil || n != 0 {
+		t.Fatalf("Expire without retention: got %d, %v", n, err)
+	}
+	b.SetRetention(30*time.Minute, time.Hour)
+	if n, err := b.Expire(); err != nil || n != 2 {
+		t.Fatalf("Expire: got %d, %v, want 2 articles", n, err)
+	}
+	if n, err := b.Expire(); err != nil || n != 0 {
+		t.Fatalf("second Expire: got %d, %v, want none", n, err)
+	}
+	b.SetRetention(0, 0)
+	group, _ := b.GetGroup("bar")
+	if group.Count != 0 {
+		t.Errorf("bar: %d articles left", group.Count)
+	}
+}
@@ -0,0 +1,63 @@
+package nntpserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/textproto"
+	"strings"
+)
+
+var ErrSASLMechanism = &NNTPError{503, "Mechanism not recognized"}
+var ErrBase64 = &NNTPError{504, "Base64 encoding error"}
+
+// handleSASL runs an AUTHINFO SASL exchange. args holds the mechanism and
+// the optional initial response. Only PLAIN (RFC 4616) is supported.
+func handleSASL(args []string, s *session, c *textproto.Conn) error {
+	if len(args) > 2 {
+		return ErrSyntax
+	}
+	if !strings.EqualFold(args[0], "plain") {
+		return ErrSASLMechanism
+	}
+
+	var response string
+	if len(args) == 2 {
+		response = args[1]
+	} else {
+		// PLAIN has no challenge, "=" stands for an empty one
+		if err := c.PrintfLine("383 ="); err != nil {
+			return err
+		}
+		line, err := c.ReadLine()
+		if err != nil {
+			return err
+		}
+		response = strings.TrimSpace(line)
+		if response == "*" {
+			// The client cancelled the exchange
+			return ErrAuthRejected
+		}
+	}
+
+	// "=" is an empty response
+	if response == "=" {
+		response = ""
+	}
+	message, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		return ErrBase64
+	}
+
+	// authzid NUL authcid NUL passwd
+	fields := bytes.Split(message, []byte{0})
+	if len(fields) != 3 || len(fields[1]) == 0 {
+		return s.authFailed(ErrAuthRejected)
+	}
+	authzid, user, pass := string(fields[0]), string(fields[1]), string(fields[2])
+	if authzid != "" && authzid != user {
+		// Acting as another user isn't supported
+		return s.authFailed(ErrAuthRejected)
+	}
+
+	return s.login(user, pass, c)
+}
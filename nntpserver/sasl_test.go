@@ -0,0 +1,53 @@
+package nntpserver
+
+import (
+	"encoding/base64"
+	"slices"
+	"testing"
+)
+
+func plain(authzid, user, pass string) string {
+	return base64.StdEncoding.EncodeToString([]byte(authzid + "\x00" + user + "\x00" + pass))
+}
+
+func TestSASLPlain(t *testing.T) {
+	s := startServer(t, Config{Auth: &AuthConfig{
+		Users:    map[string]string{"user": "pass word"},
+		Required: true,
+	}})
+
+	c := dial(t, s)
+	caps := c.capabilities()
+	for _, want := range []string{"AUTHINFO USER SASL", "SASL PLAIN"} {
+		if !slices.Contains(caps, want) {
+			t.Errorf("%q not announced before authentication: %q", want, caps)
+		}
+	}
+	c.check("480", "GROUP foo")
+
+	c.check("503", "AUTHINFO SASL CRAM-MD5")
+	c.check("504", "AUTHINFO SASL PLAIN not*base64")
+	c.check("481", "AUTHINFO SASL PLAIN %s", plain("", "user", "wrong"))
+	c.check("481", "AUTHINFO SASL PLAIN %s", plain("other", "user", "pass word"))
+	c.check("481", "AUTHINFO SASL PLAIN =")
+	c.check("383 =", "AUTHINFO SASL PLAIN")
+	c.check("481", "*")
+	c.check("381", "AUTHINFO USER user")
+	c.check("482", "AUTHINFO SASL PLAIN %s", plain("", "user", "pass word"))
+
+	c.check("383 =", "AUTHINFO SASL PLAIN")
+	c.check("281", plain("user", "user", "pass word"))
+
+	caps = c.capabilities()
+	if slices.ContainsFunc(caps, func(l string) bool {
+		return l == "SASL PLAIN" || l == "AUTHINFO USER SASL"
+	}) {
+		t.Errorf("authentication announced after it: %q", caps)
+	}
+	c.check("502", "AUTHINFO SASL PLAIN %s", plain("", "user", "pass word"))
+	c.check("211", "GROUP foo")
+
+	other := dial(t, s)
+	other.check("281", "AUTHINFO SASL PLAIN %s", plain("", "user", "pass word"))
+	other.check("211", "GROUP foo")
+}
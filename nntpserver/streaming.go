@@ -0,0 +1,128 @@
+package nntpserver
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/textproto"
+	"strings"
+)
+
+// offer reserves id for sess after it answered 238 to CHECK, so other
+// sessions are told to try later. It fails if another session holds id.
+func (s *Server) offer(id string, sess *session) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	if owner, ok := s.offers[id]; ok && owner != sess {
+		return false
+	}
+	if s.offers == nil {
+		s.offers = map[string]*session{}
+	}
+	s.offers[id] = sess
+	return true
+}
+
+// release drops the reservation of id.
+func (s *Server) release(id string) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.offers, id)
+}
+
+/*
+   Syntax
+     CHECK message-id
+
+   Responses
+     238 message-id   Send article to be transferred
+     431 message-id   Transfer not possible; try again later
+     438 message-id   Article not wanted
+*/
+
+func handleCheck(args []string, s *session, c *textproto.Conn) error {
+	if len(args) != 1 || !strings.HasPrefix(args[0], "<") {
+		return ErrSyntax
+	}
+	id := args[0]
+
+	if !s.backend.AllowPost() {
+		return c.PrintfLine("438 %s", id)
+	}
+	exists, err := hasArticle(s.backend, id)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case exists:
+		return c.PrintfLine("438 %s", id)
+	case !s.server.offer(id, s):
+		return c.PrintfLine("431 %s", id)
+	}
+	return c.PrintfLine("238 %s", id)
+}
+
+/*
+   Syntax
+     TAKETHIS message-id
+
+   Responses
+     239 message-id   Article transferred OK
+     439 message-id   Transfer rejected; do not retry
+
+   The article follows the command line without waiting for a response
+   and is read even when it is rejected.
+*/
+
+func handleTakeThis(args []string, s *session, c *textproto.Conn) error {
+	if len(args) != 1 || !strings.HasPrefix(args[0], "<") {
+		discardArticle(c)
+		return ErrSyntax
+	}
+	id := args[0]
+	defer s.server.release(id)
+
+	header, herr := c.ReadMIMEHeader()
+	body, err := io.ReadAll(c.DotReader())
+	if err != nil {
+		return err
+	}
+	if herr != nil || !s.backend.AllowPost() {
+		return c.PrintfLine("439 %s", id)
+	}
+
+	// The message-id of the command and the article must agree
+	if header.Get("Message-Id") == "" {
+		header.Set("Message-Id", id)
+	}
+	if header.Get("Message-Id") != id {
+		return c.PrintfLine("439 %s", id)
+	}
+	header.Del("Xref")
+
+	if err := s.backend.Post(&Article{Header: header, Body: bytes.NewReader(body)}); err != nil {
+		if err != ErrDuplicateArticle {
+			log.Printf("Rejecting %s: %v", id, err)
+		}
+		return c.PrintfLine("439 %s", id)
+	}
+	return c.PrintfLine("239 %s", id)
+}
+
+// skipArticle reads the article sent along with a TAKETHIS that is refused
+// before its handler runs, so the next command is read from the right
+// place.
+func skipArticle(cmd string, c *textproto.Conn) {
+	if strings.EqualFold(cmd, "takethis") {
+		discardArticle(c)
+	}
+}
+
+// discardArticle reads and drops the dot-terminated article that follows a
+// TAKETHIS command line.
+func discardArticle(c *textproto.Conn) {
+	c.ReadMIMEHeader()
+	io.Copy(io.Discard, c.DotReader())
+}
@@ -0,0 +1,79 @@
+package nntpserver
+
+import "testing"
+
+func TestStreaming(t *testing.T) {
+	for name, backend := range map[string]func() Backend{
+		"checker": func() Backend { return NewMemoryBackend() },
+		"plain":   func() Backend { return plainBackend{NewMemoryBackend()} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := serveBackend(t, backend(), Config{})
+			postArticles(t, s.Backend, "foo", "<old@test>")
+
+			c := dial(t, s)
+			c.check("203", "MODE STREAM")
+
+			c.check("438 <old@test>", "CHECK <old@test>")
+			c.check("238 <new@test>", "CHECK <new@test>")
+			c.check("501", "CHECK new@test")
+
+			// Another session must wait for the offered article
+			other := dial(t, s)
+			other.check("431 <new@test>", "CHECK <new@test>")
+
+			c.check("239 <new@test>",
+				"TAKETHIS <new@test>\r\nNewsgroups: foo\r\nSubject: new\r\n\r\nbody\r\n.")
+			c.check("438 <new@test>", "CHECK <new@test>")
+			other.check("438 <new@test>", "CHECK <new@test>")
+
+			// Rejected articles are read all the same
+			c.check("439 <new@test>",
+				"TAKETHIS <new@test>\r\nNewsgroups: foo\r\n\r\nagain\r\n.")
+			c.check("439 <other@test>",
+				"TAKETHIS <other@test>\r\nMessage-Id: <wrong@test>\r\nNewsgroups: foo\r\n\r\nbody\r\n.")
+
+			c.check("211 2 1 2 foo", "GROUP foo")
+			c.check("223 2 <new@test>", "STAT 2")
+		})
+	}
+}
+
+func TestTakeThisRefusedBeforeHandler(t *testing.T) {
+	const article = "TAKETHIS <a@test>\r\nNewsgroups: foo\r\n\r\n.. dotted line\r\nbody\r\n."
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		s := startServer(t, Config{Auth: &AuthConfig{
+			Users:    map[string]string{"user": "pass"},
+			Required: true,
+		}})
+
+		c := dial(t, s)
+		c.check("480", article)
+		c.check("101", "CAPABILITIES")
+		c.block()
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		s := startServer(t, Config{Faults: []FaultRule{{
+			Command:          "takethis",
+			ErrorProbability: 1,
+			ErrorCode:        400,
+		}}})
+
+		c := dial(t, s)
+		c.check("400", article)
+		c.check("211 0", "GROUP foo")
+	})
+}
+
+func TestTakeThisSyntaxError(t *testing.T) {
+	s := startServer(t, Config{})
+
+	c := dial(t, s)
+	for _, cmd := range []string{"TAKETHIS", "TAKETHIS a@test", "TAKETHIS <a@test> extra"} {
+		c.check("501", "%s\r\nNewsgroups: foo\r\nSubject: x\r\n\r\nGROUP foo\r\n.", cmd)
+	}
+	c.check("239 <b@test>", "TAKETHIS <b@test>\r\nNewsgroups: foo\r\n\r\nbody\r\n.")
+	c.check("211 1 1 1 foo", "GROUP foo")
+}
@@ -0,0 +1,171 @@
+package nntpserver
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// BandwidthConfig limits how fast the server writes to clients.
+// Rates are in bytes per second, 0 means unlimited.
+type BandwidthConfig struct {
+	// Shared by all connections
+	Global int `yaml:"global"`
+	// Applied to each connection on its own
+	PerConnection int `yaml:"per_connection"`
+	// Shared by the connections of each authenticated user
+	PerUser int `yaml:"per_user"`
+	// Per-user overrides of PerUser
+	Users map[string]int `yaml:"users"`
+	// Bucket size in bytes, the most that is sent without waiting
+	// (defaults to one second worth of the rate)
+	Burst int `yaml:"burst"`
+}
+
+// tokenBucket allows rate bytes per second with bursts of up to burst bytes.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// reserve takes n tokens and returns how long to wait before using them.
+func (b *tokenBucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// throttle limits the writes of one session. The user bucket is added once
+// the session authenticates.
+type throttle struct {
+	mu      sync.Mutex
+	buckets []*tokenBucket
+}
+
+func (t *throttle) add(b *tokenBucket) {
+	if b == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buckets = append(t.buckets, b)
+}
+
+// wait blocks until n bytes may be written.
+func (t *throttle) wait(n int) {
+	if delay := t.reserve(n); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// reserve takes n tokens from every bucket and returns how long to wait
+// for the slowest of them.
+func (t *throttle) reserve(n int) time.Duration {
+	t.mu.Lock()
+	buckets := t.buckets
+	t.mu.Unlock()
+
+	var delay time.Duration
+	for _, b := range buckets {
+		if d := b.reserve(n); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+// chunk returns the largest write that fits in every bucket.
+func (t *throttle) chunk(n int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, b := range t.buckets {
+		if b.burst < n {
+			n = b.burst
+		}
+	}
+	return n
+}
+
+// throttledConn paces writes to the underlying connection.
+type throttledConn struct {
+	net.Conn
+	throttle *throttle
+}
+
+func (tc *throttledConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := tc.throttle.chunk(len(p) - written)
+		tc.throttle.wait(n)
+		m, err := tc.Conn.Write(p[written : written+n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// newThrottle returns the throttle for a new connection.
+func (s *Server) newThrottle() *throttle {
+	t := &throttle{}
+	t.add(s.globalBucket)
+	t.add(newTokenBucket(s.config.Bandwidth.PerConnection, s.config.Bandwidth.Burst))
+	return t
+}
+
+// userBucket returns the bucket shared by the connections of user.
+func (s *Server) userBucket(user string) *tokenBucket {
+	rate, ok := s.config.Bandwidth.Users[user]
+	if !ok {
+		rate = s.config.Bandwidth.PerUser
+	}
+	if rate <= 0 {
+		return nil
+	}
+
+	s.bucketsMu.Lock()
+	defer s.bucketsMu.Unlock()
+
+	if s.userBuckets == nil {
+		s.userBuckets = map[string]*tokenBucket{}
+	}
+	b := s.userBuckets[user]
+	if b == nil {
+		b = newTokenBucket(rate, s.config.Bandwidth.Burst)
+		s.userBuckets[user] = b
+	}
+	return b
+}
@@ -0,0 +1,108 @@
+package nntpserver
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestBucket returns a token bucket running on clock.
+func newTestBucket(clock *fakeClock, rate, burst int) *tokenBucket {
+	b := newTokenBucket(rate, burst)
+	b.now = clock.Now
+	b.last = clock.Now()
+	return b
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBucket(clock, 1000, 500)
+
+	for _, tc := range []struct {
+		advance time.Duration
+		n       int
+		want    time.Duration
+	}{
+		// A full bucket sends a burst at once
+		{0, 500, 0},
+		{0, 100, 100 * time.Millisecond},
+		// Refilled tokens pay the debt first
+		{100 * time.Millisecond, 100, 100 * time.Millisecond},
+		{200 * time.Millisecond, 50, 0},
+		// The bucket holds no more than the burst
+		{10 * time.Second, 500, 0},
+		{0, 1, time.Millisecond},
+	} {
+		clock.advance(tc.advance)
+		if got := b.reserve(tc.n); got != tc.want {
+			t.Errorf("after %v, reserving %d: got %v, want %v", tc.advance, tc.n, got, tc.want)
+		}
+	}
+
+	// The burst defaults to one second of the rate
+	b = newTestBucket(clock, 1000, 0)
+	if got := b.reserve(1000); got != 0 {
+		t.Errorf("default burst: waited %v for the first second", got)
+	}
+	if got := b.reserve(1000); got != time.Second {
+		t.Errorf("default burst: got %v, want %v", got, time.Second)
+	}
+
+	if b := newTokenBucket(0, 100); b != nil {
+		t.Error("a zero rate made a bucket")
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	clock := newFakeClock()
+	global := newTestBucket(clock, 10000, 4000)
+	conn := newTestBucket(clock, 1000, 1000)
+
+	th := &throttle{}
+	th.add(nil)
+	if got := th.chunk(5000); got != 5000 {
+		t.Errorf("without buckets: chunk %d, want 5000", got)
+	}
+	if got := th.reserve(5000); got != 0 {
+		t.Errorf("without buckets: waited %v", got)
+	}
+
+	th.add(global)
+	th.add(conn)
+	// Writes are cut to the smallest burst and wait for the slowest bucket
+	if got := th.chunk(5000); got != 1000 {
+		t.Errorf("chunk %d, want 1000", got)
+	}
+	if got := th.reserve(1000); got != 0 {
+		t.Errorf("first chunk waited %v", got)
+	}
+	if got := th.reserve(1000); got != time.Second {
+		t.Errorf("second chunk: got %v, want %v", got, time.Second)
+	}
+
+	// A bucket shared with other sessions slows this one down
+	clock.advance(2 * time.Second)
+	global.reserve(20000)
+	if got := th.reserve(500); got != 1650*time.Millisecond {
+		t.Errorf("with the global bucket drained: got %v, want 1.65s", got)
+	}
+}
+
+func TestUserBucket(t *testing.T) {
+	s := startServer(t, Config{Bandwidth: BandwidthConfig{
+		PerUser: 1000,
+		Users:   map[string]int{"fast": 5000, "free": 0},
+	}})
+
+	if s.userBucket("a") != s.userBucket("a") {
+		t.Error("connections of a user get their own buckets")
+	}
+	if s.userBucket("a") == s.userBucket("b") {
+		t.Error("users share a bucket")
+	}
+	if b := s.userBucket("fast"); b == nil || b.rate != 5000 {
+		t.Errorf("override ignored: got %+v", b)
+	}
+	if b := s.userBucket("free"); b != nil {
+		t.Error("a zero override is limited")
+	}
+}
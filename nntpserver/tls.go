@@ -0,0 +1,159 @@
+package nntpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/textproto"
+	"time"
+)
+
+var ErrTLSNotAvailable = &NNTPError{580, "Can not initiate TLS negotiation"}
+var ErrCommandUnavailable = &NNTPError{502, "Command unavailable"}
+
+// TLSConfig holds the TLS options of the server.
+type TLSConfig struct {
+	// PEM encoded certificate and key files. When both are empty a
+	// self-signed CA and leaf certificate are generated at startup.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// Serve TLS from the first byte (port 563 style) instead of
+	// waiting for STARTTLS
+	Implicit bool `yaml:"implicit"`
+	// Names the generated leaf certificate is valid for
+	// (defaults to localhost, 127.0.0.1 and ::1)
+	Hosts []string `yaml:"hosts"`
+}
+
+// newTLSConfig loads or generates the server certificate. The returned pool
+// holds the generated CA and is nil when the certificate came from files.
+func newTLSConfig(config *TLSConfig) (*tls.Config, *x509.CertPool, error) {
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading key pair: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil, nil
+	}
+
+	hosts := config.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+
+	cert, ca, err := generateCertificate(hosts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, pool, nil
+}
+
+// generateCertificate creates an in-memory CA and a leaf certificate for
+// hosts signed by it.
+func generateCertificate(hosts []string) (tls.Certificate, *x509.Certificate, error) {
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(365 * 24 * time.Hour)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "nntp-server-mock CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			leafTemplate.IPAddresses = append(leafTemplate.IPAddresses, ip)
+		} else {
+			leafTemplate.DNSNames = append(leafTemplate.DNSNames, h)
+		}
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{leafDER, caDER},
+		PrivateKey:  leafKey,
+	}, ca, nil
+}
+
+// RootCAs returns a pool holding the CA of the generated certificate, for
+// clients to trust. It is nil when TLS is disabled or the certificate was
+// loaded from files.
+func (s *Server) RootCAs() *x509.CertPool {
+	return s.rootCAs
+}
+
+/*
+   Syntax
+     STARTTLS
+
+   Responses
+     382    Continue with TLS negotiation
+     502    Command unavailable [1]
+     580    Can not initiate TLS negotiation
+
+   [1] The 502 response is sent if the session is already using TLS or
+   compression, or has authenticated.
+*/
+
+func handleStartTLS(args []string, s *session, c *textproto.Conn) error {
+	if s.server.tlsConfig == nil {
+		return ErrTLSNotAvailable
+	}
+	if s.tls || s.compressed || s.user != "" {
+		return ErrCommandUnavailable
+	}
+
+	if err := c.PrintfLine("382 Continue with TLS negotiation"); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Server(s.conn, s.server.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	s.setConn(tlsConn)
+	s.tls = true
+
+	return nil
+}
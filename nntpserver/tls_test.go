@@ -0,0 +1,50 @@
+package nntpserver
+
+import (
+	"crypto/tls"
+	"net/textproto"
+	"slices"
+	"testing"
+)
+
+func TestStartTLS(t *testing.T) {
+	s := startServer(t, Config{
+		TLS:  &TLSConfig{},
+		Auth: &AuthConfig{Users: map[string]string{"user": "pass"}},
+	})
+
+	c := dial(t, s)
+	if !slices.Contains(c.capabilities(), "STARTTLS") {
+		t.Fatal("STARTTLS not announced before TLS")
+	}
+	c.check("382", "STARTTLS")
+
+	conn := tls.Client(c.conn, &tls.Config{ServerName: "localhost", RootCAs: s.RootCAs()})
+	if err := conn.Handshake(); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	c.Conn = textproto.NewConn(conn)
+
+	if slices.Contains(c.capabilities(), "STARTTLS") {
+		t.Error("STARTTLS announced on a TLS session")
+	}
+	c.check("502", "STARTTLS")
+	c.check("381", "AUTHINFO USER user")
+	c.check("281", "AUTHINFO PASS pass")
+}
+
+func TestStartTLSAfterAuth(t *testing.T) {
+	s := startServer(t, Config{
+		TLS:  &TLSConfig{},
+		Auth: &AuthConfig{Users: map[string]string{"user": "pass"}},
+	})
+
+	c := dial(t, s)
+	c.check("381", "AUTHINFO USER user")
+	c.check("281", "AUTHINFO PASS pass")
+	if slices.Contains(c.capabilities(), "STARTTLS") {
+		t.Error("STARTTLS announced after authentication")
+	}
+	c.check("502", "STARTTLS")
+	c.check("211", "GROUP foo")
+}
@@ -0,0 +1,134 @@
+// Package yenc encodes binary data as yEnc 1.3 article bodies.
+package yenc
+
+import (
+	"bufio"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// DefaultLineLength is the number of encoded characters per line used
+// when none is given.
+const DefaultLineLength = 128
+
+// Part is the slice of a file carried by one article.
+type Part struct {
+	Name   string
+	Number int // 1-based
+	Total  int
+	Begin  int64  // offset of Data in the file
+	Size   int64  // size of the whole file
+	CRC32  uint32 // checksum of the whole file
+	Data   []byte
+}
+
+// Split cuts data into parts of at most partSize bytes. A partSize of zero
+// or less, or one covering all of data, gives a single part.
+func Split(name string, data []byte, partSize int) []Part {
+	if partSize <= 0 || partSize > len(data) {
+		partSize = max(len(data), 1)
+	}
+	total := max((len(data)+partSize-1)/partSize, 1)
+	crc := crc32.ChecksumIEEE(data)
+
+	parts := make([]Part, total)
+	for i := range parts {
+		begin := min(i*partSize, len(data))
+		end := min(begin+partSize, len(data))
+		parts[i] = Part{
+			Name:   name,
+			Number: i + 1,
+			Total:  total,
+			Begin:  int64(begin),
+			Size:   int64(len(data)),
+			CRC32:  crc,
+			Data:   data[begin:end],
+		}
+	}
+	return parts
+}
+
+// SplitN cuts data into n parts of nearly equal size.
+func SplitN(name string, data []byte, n int) []Part {
+	if n <= 1 {
+		return Split(name, data, 0)
+	}
+	return Split(name, data, (len(data)+n-1)/n)
+}
+
+// End returns the offset just past the part in the file.
+func (p Part) End() int64 {
+	return p.Begin + int64(len(p.Data))
+}
+
+// PCRC32 returns the checksum of the part data.
+func (p Part) PCRC32() uint32 {
+	return crc32.ChecksumIEEE(p.Data)
+}
+
+// Multipart reports whether the part uses the =ypart form.
+func (p Part) Multipart() bool {
+	return p.Total > 1
+}
+
+// Subject returns the customary subject of the part's article,
+// `"name" yEnc (1/N)`.
+func (p Part) Subject() string {
+	return fmt.Sprintf(`"%s" yEnc (%d/%d)`, p.Name, p.Number, p.Total)
+}
+
+// Encode writes the part as an article body with at most lineLength
+// encoded characters per line, DefaultLineLength if lineLength is zero
+// or less. An escape sequence may run one character past the limit.
+func (p Part) Encode(w io.Writer, lineLength int) error {
+	if lineLength <= 0 {
+		lineLength = DefaultLineLength
+	}
+
+	bw := bufio.NewWriter(w)
+	if p.Multipart() {
+		fmt.Fprintf(bw, "=ybegin part=%d total=%d line=%d size=%d name=%s\n", p.Number, p.Total, lineLength, p.Size, p.Name)
+		fmt.Fprintf(bw, "=ypart begin=%d end=%d\n", p.Begin+1, p.End())
+	} else {
+		fmt.Fprintf(bw, "=ybegin line=%d size=%d name=%s\n", lineLength, p.Size, p.Name)
+	}
+
+	encodeLines(bw, p.Data, lineLength)
+
+	if p.Multipart() {
+		fmt.Fprintf(bw, "=yend size=%d part=%d pcrc32=%08x crc32=%08x\n", len(p.Data), p.Number, p.PCRC32(), p.CRC32)
+	} else {
+		fmt.Fprintf(bw, "=yend size=%d crc32=%08x\n", len(p.Data), p.CRC32)
+	}
+
+	return bw.Flush()
+}
+
+// encodeLines writes data in yEnc encoding. NUL, LF, CR and '=' are always
+// escaped, TAB and SPACE only at the start and end of a line where
+// transports may strip them. Leading dots are left to NNTP dot-stuffing.
+func encodeLines(w *bufio.Writer, data []byte, lineLength int) {
+	col := 0
+	for i, b := range data {
+		c := b + 42
+		edge := col == 0 || col == lineLength-1 || i == len(data)-1
+		switch {
+		case c == 0, c == '\n', c == '\r', c == '=',
+			(c == '\t' || c == ' ') && edge:
+			w.WriteByte('=')
+			w.WriteByte(c + 64)
+			col += 2
+		default:
+			w.WriteByte(c)
+			col++
+		}
+		if col >= lineLength {
+			w.WriteByte('\n')
+			col = 0
+		}
+	}
+	if col > 0 {
+		w.WriteByte('\n')
+	}
+}
@@ -0,0 +1,179 @@
+package yenc
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+// decode returns the header lines and the data of an encoded part.
+func decode(t *testing.T, body string) (headers []string, data []byte) {
+	t.Helper()
+
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		if strings.HasPrefix(line, "=y") {
+			headers = append(headers, line)
+			continue
+		}
+		for i := 0; i < len(line); i++ {
+			b := line[i]
+			if b == '=' {
+				i++
+				if i == len(line) {
+					t.Fatalf("escape at the end of line %q", line)
+				}
+				b = line[i] - 64
+			}
+			data = append(data, b-42)
+		}
+	}
+	return headers, data
+}
+
+// raw returns the data that encodes to the characters of s.
+func raw(s string) []byte {
+	data := []byte(s)
+	for i := range data {
+		data[i] -= 42
+	}
+	return data
+}
+
+func encode(t *testing.T, p Part, lineLength int) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf, lineLength); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	var data []byte
+	for i := 0; i < 3; i++ {
+		for b := 0; b < 256; b++ {
+			data = append(data, byte(b))
+		}
+	}
+
+	for _, lineLength := range []int{2, 3, 64, 128, 0} {
+		for _, partSize := range []int{0, 100, 256} {
+			var got []byte
+			for _, p := range Split("all.bin", data, partSize) {
+				body := encode(t, p, lineLength)
+				limit := lineLength
+				if limit <= 0 {
+					limit = DefaultLineLength
+				}
+				for _, line := range strings.Split(body, "\n") {
+					if !strings.HasPrefix(line, "=y") && len(line) > limit+1 {
+						t.Errorf("line=%d: line of %d characters", lineLength, len(line))
+					}
+				}
+
+				_, part := decode(t, body)
+				got = append(got, part...)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("line=%d part=%d: data changed in the round trip", lineLength, partSize)
+			}
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		data       []byte
+		lineLength int
+		want       string
+	}{
+		{"critical", raw("x\x00\n\r=x"), 128, "x=@=J=M=}x\n"},
+		{"dot", raw(".x"), 128, ".x\n"},
+		// TAB and SPACE are escaped at the start and end of lines only
+		{"edges", raw(" ab  \tc\t"), 4, "=`ab\n=` =I\nc=I\n"},
+		{"middle", raw("a \tb"), 128, "a \tb\n"},
+		{"last", raw("a "), 128, "a=`\n"},
+	} {
+		body := encode(t, Split("e", tc.data, 0)[0], tc.lineLength)
+		lines := strings.SplitAfterN(body, "\n", 2)
+		got := strings.TrimSuffix(lines[1], fmt.Sprintf("=yend size=%d crc32=%08x\n",
+			len(tc.data), crc32.ChecksumIEEE(tc.data)))
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+		if _, data := decode(t, body); !bytes.Equal(data, tc.data) {
+			t.Errorf("%s: decoded %q, want %q", tc.name, data, tc.data)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	data := make([]byte, 300)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	crc := crc32.ChecksumIEEE(data)
+
+	headers, _ := decode(t, encode(t, Split("file.bin", data, 0)[0], 0))
+	want := []string{
+		"=ybegin line=128 size=300 name=file.bin",
+		fmt.Sprintf("=yend size=300 crc32=%08x", crc),
+	}
+	if fmt.Sprint(headers) != fmt.Sprint(want) {
+		t.Errorf("single part: got %q, want %q", headers, want)
+	}
+
+	parts := Split("file.bin", data, 128)
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want 3", len(parts))
+	}
+	for i, p := range parts {
+		begin, end := i*128, min((i+1)*128, len(data))
+		headers, _ := decode(t, encode(t, p, 64))
+		want := []string{
+			fmt.Sprintf("=ybegin part=%d total=3 line=64 size=300 name=file.bin", i+1),
+			fmt.Sprintf("=ypart begin=%d end=%d", begin+1, end),
+			fmt.Sprintf("=yend size=%d part=%d pcrc32=%08x crc32=%08x",
+				end-begin, i+1, crc32.ChecksumIEEE(data[begin:end]), crc),
+		}
+		if fmt.Sprint(headers) != fmt.Sprint(want) {
+			t.Errorf("part %d: got %q, want %q", i+1, headers, want)
+		}
+		if got := p.Subject(); got != fmt.Sprintf(`"file.bin" yEnc (%d/3)`, i+1) {
+			t.Errorf("part %d: subject %q", i+1, got)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	for _, tc := range []struct {
+		size, partSize int
+		want           []int
+	}{
+		{0, 0, []int{0}},
+		{10, 0, []int{10}},
+		{10, 20, []int{10}},
+		{10, 4, []int{4, 4, 2}},
+		{12, 4, []int{4, 4, 4}},
+	} {
+		var got []int
+		for _, p := range Split("s", make([]byte, tc.size), tc.partSize) {
+			got = append(got, len(p.Data))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("Split(%d, %d): got sizes %v, want %v", tc.size, tc.partSize, got, tc.want)
+		}
+	}
+
+	var got []int
+	for _, p := range SplitN("s", make([]byte, 10), 3) {
+		got = append(got, len(p.Data))
+	}
+	if fmt.Sprint(got) != "[4 4 2]" {
+		t.Errorf("SplitN(10, 3): got sizes %v, want [4 4 2]", got)
+	}
+}